@@ -1,26 +1,56 @@
 package main
 
 import (
+	"flag"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/litao91/lychee_go/modules"
+	"github.com/litao91/lychee_go/util/helper"
 	"github.com/litao91/lychee_go/util/log"
+	"github.com/litao91/lychee_go/util/mysqldump"
 )
 
 func main() {
-	wd, err := filepath.Abs(os.Args[1])
+	sessionStore := flag.String("session-store", "cookie", "where sessions are kept: cookie or db")
+	sessionIdle := flag.Duration("session-idle", 2*time.Hour, "idle timeout of sessions, db store only (0 to disable)")
+	sessionMax := flag.Duration("session-max", 30*24*time.Hour, "absolute lifetime of sessions (0 to disable)")
+	database := flag.String("db", "sqlite", "where the library is kept: sqlite or mysql")
+	dsn := flag.String("dsn", "", "data source name of the mysql database, e.g. lychee:secret@tcp(localhost:3306)/lychee")
+	flag.Parse()
+	if flag.NArg() == 2 && flag.Arg(0) == "migrate" {
+		migrate(*database, *dsn, flag.Arg(1))
+		return
+	}
+	if (flag.NArg() == 3 || flag.NArg() == 4) && flag.Arg(0) == "import" {
+		importDump(*database, *dsn, flag.Arg(1), flag.Arg(2), flag.Arg(3))
+		return
+	}
+	if flag.NArg() < 2 {
+		log.Error("Usage: %s [flags] <lychee-src-path> <data-path>", os.Args[0])
+		log.Error("       %s migrate <data-path>", os.Args[0])
+		log.Error("       %s import <dump.sql> <data-path> [php-uploads-path]", os.Args[0])
+		os.Exit(2)
+	}
+
+	wd, err := filepath.Abs(flag.Arg(0))
 	log.Info("Working directory: %s", wd)
 	if err != nil {
 		log.Error("%v", err)
 	}
-	dd, err := filepath.Abs(os.Args[2])
+	dd, err := filepath.Abs(flag.Arg(1))
 	if err != nil {
 		log.Error("%v", err)
 		return
 	}
 	log.Info("Data directory: %s", dd)
 	s := modules.NewServer(wd, dd, 3334)
+	s.SessionStore = *sessionStore
+	s.SessionIdleTimeout = *sessionIdle
+	s.SessionMaxAge = *sessionMax
+	s.Database = *database
+	s.DatabaseDSN = *dsn
 	err = s.Init()
 	if err != nil {
 		log.Error("%v", err)
@@ -28,3 +58,74 @@ func main() {
 	}
 	s.Run()
 }
+
+// migrate brings the schema of the library in dataPath up to date without
+// starting the server
+func migrate(database string, dsn string, dataPath string) {
+	dd, err := filepath.Abs(dataPath)
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	db, err := modules.NewDatabase(database, dsn, dd)
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	err = db.Open()
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	from, applied, err := db.Migrate()
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	if len(applied) == 0 {
+		log.Info("Schema is up to date at version %d", from)
+		return
+	}
+	log.Info("Migrated schema from version %d to %d", from, applied[len(applied)-1].Version)
+}
+
+// importDump adds a PHP Lychee mysqldump, and the files in its uploads
+// directory if given, to the library in dataPath
+func importDump(database string, dsn string, dumpPath string, dataPath string, uploadsPath string) {
+	dd, err := filepath.Abs(dataPath)
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	f, err := os.Open(dumpPath)
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	dump, err := mysqldump.Parse(f)
+	f.Close()
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	helper.CreateDirIfNotExists(dd)
+	db, err := modules.NewDatabase(database, dsn, dd)
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	err = db.InitDb()
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+	r, err := modules.ImportDump(db, dump, dd, uploadsPath)
+	if err != nil {
+		log.Error("%v", err)
+		os.Exit(1)
+	}
+	log.Info("Imported %d albums, %d photos, %d settings and %d files, skipped %d rows already in the library",
+		r.Albums, r.Photos, r.Settings, r.Files, r.Skipped)
+}
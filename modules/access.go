@@ -0,0 +1,186 @@
+package modules
+
+import (
+	"database/sql"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// The frontend asks guests for the password or shows an error when it gets
+// one of these instead of an album or photo
+const (
+	warningAlbumPrivate  = "Warning: Album private!"
+	warningWrongPassword = "Warning: Wrong password!"
+	warningPhotoPrivate  = "Warning: Photo private!"
+)
+
+// unlockedAlbumsKey is the session key of the password protected albums the
+// guest entered the password for
+const unlockedAlbumsKey = "unlocked_albums"
+
+// unlockedAlbums returns the albums unlocked in this session
+func unlockedAlbums(c *gin.Context) []int64 {
+	ids, _ := sessions.Default(c).Get(unlockedAlbumsKey).([]int64)
+	return ids
+}
+
+// unlockAlbum lets the session open the password protected album
+func unlockAlbum(c *gin.Context, albumID int64) error {
+	if albumUnlocked(c, albumID) {
+		return nil
+	}
+	session := sessions.Default(c)
+	session.Set(unlockedAlbumsKey, append(unlockedAlbums(c), albumID))
+	return session.Save()
+}
+
+// shareTokensKey is the session key of the share links opened in the session
+const shareTokensKey = "share_tokens"
+
+// shareTokens returns the share links opened in this session
+func shareTokens(c *gin.Context) []string {
+	tokens, _ := sessions.Default(c).Get(shareTokensKey).([]string)
+	return tokens
+}
+
+// maxShareTokens is the most share links a session remembers, the least
+// recently opened are forgotten first. Sessions are kept in a cookie by
+// default, which browsers cap at about 4 KB.
+const maxShareTokens = 20
+
+// addShareToken lets the session see what the share link points to, for as
+// long as the link is valid. Links that expired or were deleted are dropped
+// from the session.
+func addShareToken(conn *sql.DB, c *gin.Context, token string) error {
+	valid := map[string]bool{}
+	if shared, args := sharedBy(c, "token"); shared != "" {
+		rows, err := conn.Query(shared, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var t string
+			if err = rows.Scan(&t); err != nil {
+				return err
+			}
+			valid[t] = true
+		}
+		if err = rows.Err(); err != nil {
+			return err
+		}
+	}
+	tokens := []string{}
+	for _, t := range shareTokens(c) {
+		if valid[t] && t != token {
+			tokens = append(tokens, t)
+		}
+	}
+	tokens = append(tokens, token)
+	if len(tokens) > maxShareTokens {
+		tokens = tokens[len(tokens)-maxShareTokens:]
+	}
+	session := sessions.Default(c)
+	session.Set(shareTokensKey, tokens)
+	return session.Save()
+}
+
+// sharedBy returns a subquery selecting the column of the valid share links
+// opened in this session, "" if there are none
+func sharedBy(c *gin.Context, column string) (string, []interface{}) {
+	tokens := shareTokens(c)
+	if len(tokens) == 0 {
+		return "", nil
+	}
+	placeholders := make([]string, len(tokens))
+	args := make([]interface{}, 0, len(tokens)+1)
+	for i, t := range tokens {
+		placeholders[i] = "?"
+		args = append(args, t)
+	}
+	args = append(args, time.Now().Unix())
+	return "SELECT " + column + " FROM lychee_shares WHERE token IN (" + strings.Join(placeholders, ", ") +
+		") AND (expires = 0 OR expires > ?)", args
+}
+
+// albumUnlocked reports whether the password of the album was entered in
+// this session
+func albumUnlocked(c *gin.Context, albumID int64) bool {
+	for _, id := range unlockedAlbums(c) {
+		if id == albumID {
+			return true
+		}
+	}
+	return false
+}
+
+// albumAccess returns a condition on lychee_albums matching the albums the
+// session may open: all of them once logged in, otherwise the public albums
+// without a password or with one entered in this session and the albums of
+// share links opened in it
+func albumAccess(c *gin.Context) (string, []interface{}) {
+	if isLoggedIn(c) {
+		return "1 = 1", nil
+	}
+	cond := "(public = 1 AND (password IS NULL OR password = ''"
+	var args []interface{}
+	if ids := unlockedAlbums(c); len(ids) > 0 {
+		var in string
+		in, args = inClause(ids)
+		cond += " OR id IN (" + in + ")"
+	}
+	cond += ")"
+	if shared, sharedArgs := sharedBy(c, "album"); shared != "" {
+		cond += " OR id IN (" + shared + ")"
+		args = append(args, sharedArgs...)
+	}
+	return "(trashed = 0 AND " + cond + "))", args
+}
+
+// photoAccess returns a condition on lychee_photos matching the photos the
+// session may see: all of them once logged in, otherwise the public photos,
+// the photos of the albums it may open and those of share links opened in
+// it, never those in the trash
+func photoAccess(c *gin.Context) (string, []interface{}) {
+	if isLoggedIn(c) {
+		return "1 = 1", nil
+	}
+	albums, args := albumAccess(c)
+	cond := "public = 1 OR album IN (SELECT id FROM lychee_albums WHERE " + albums + ")"
+	if shared, sharedArgs := sharedBy(c, "photo"); shared != "" {
+		cond += " OR id IN (" + shared + ")"
+		args = append(args, sharedArgs...)
+	}
+	return "(trashed = 0 AND (" + cond + "))", args
+}
+
+// canOpenAlbum reports whether the session may open the album
+func canOpenAlbum(conn *sql.DB, c *gin.Context, albumID int64) (bool, error) {
+	cond, args := albumAccess(c)
+	var count int
+	err := conn.QueryRow("SELECT COUNT(*) FROM lychee_albums WHERE id = ? AND "+cond, append([]interface{}{albumID}, args...)...).Scan(&count)
+	return count > 0, err
+}
+
+// fileAccessible reports whether the session may fetch the file, given by
+// its path relative to the data directory, of a photo. Files are shared by
+// photos with the same checksum, any of them visible to the session will do.
+// Logged in sessions may fetch any file without a lookup.
+func fileAccessible(conn *sql.DB, c *gin.Context, file string) (bool, error) {
+	if isLoggedIn(c) {
+		return true, nil
+	}
+	thumb := file
+	if ext := path.Ext(file); strings.HasSuffix(strings.TrimSuffix(file, ext), "@2x") {
+		thumb = strings.TrimSuffix(file, "@2x"+ext) + ext
+	}
+	cond, args := photoAccess(c)
+	var count int
+	err := conn.QueryRow("SELECT COUNT(*) FROM lychee_photos WHERE (url = ? OR thumbUrl = ? OR medium = ?) AND "+cond,
+		append([]interface{}{file, thumb, file}, args...)...).Scan(&count)
+	return count > 0, err
+}
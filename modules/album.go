@@ -13,30 +13,49 @@ import (
 )
 
 type Album struct {
-	Id           int    `json:"id"`
+	Id           int64  `json:"id"`
 	Title        string `json:"title"`
 	Description  string `json:"description"`
 	sysstamp     int64
-	Sysdate      string   `json:"sysdate"`
-	Public       int      `json:"public"`
-	Visible      int      `json:"visible"`
-	Downloadable int      `json:"downloadable"`
-	Password     int      `json:"password"`
-	ThumbUrls    []string `json:"thumbs"`
+	Sysdate      string `json:"sysdate"`
+	Public       int    `json:"public"`
+	Visible      int    `json:"visible"`
+	Downloadable int    `json:"downloadable"`
+	// Password is "1" for password protected albums, the hash never leaves
+	// the database
+	Password  string   `json:"password"`
+	ThumbUrls []string `json:"thumbs"`
+	Trashed   int64    `json:"trashed,omitempty"`
 }
 
 func (a *Album) FillThumbs(s *LycheeServer, conn *sql.DB) (err error) {
+	settings, err := s.GetSettings()
+	if err != nil {
+		return
+	}
 	a.ThumbUrls = make([]string, 0, 3)
-	rows, err := conn.Query("SELECT thumbUrl FROM lychee_photos WHERE album = ? ORDER BY star DESC, "+s.Settings.SortingPhotos, a.Id)
+	sorting := settings.PhotoSorting().First(SortKey{Column: "star", Desc: true})
+	a.ThumbUrls, err = loadThumbUrls(conn, "SELECT thumbUrl FROM lychee_photos WHERE album = ? AND trashed = ?"+sorting.OrderBy(), a.Id, a.Trashed)
+	return
+}
+
+// loadThumbUrls runs a query selecting thumbUrl and collects the results
+func loadThumbUrls(conn *sql.DB, query string, args ...interface{}) (thumbs []string, err error) {
+	thumbs = make([]string, 0, 3)
+	rows, err := conn.Query(query, args...)
 	if err != nil {
 		return
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var thumbUrl string
-		rows.Scan(&thumbUrl)
-		a.ThumbUrls = append(a.ThumbUrls, thumbUrl)
+		err = rows.Scan(&thumbUrl)
+		if err != nil {
+			return
+		}
+		thumbs = append(thumbs, thumbUrl)
 	}
+	err = rows.Err()
 	return
 }
 
@@ -52,108 +71,121 @@ func (a *Album) PrepareData(s *LycheeServer, conn *sql.DB) (err error) {
 }
 
 func GetSmartAlbums(s *LycheeServer, conn *sql.DB) (r map[string]map[string]interface{}, err error) {
+	settings, err := s.GetSettings()
+	if err != nil {
+		log.Error("%v", err)
+		return
+	}
+	orderBy := settings.PhotoSorting().OrderBy()
 	r = make(map[string]map[string]interface{})
-	// unsorted
-	unsorted := make(map[string]interface{})
-	unsortedThumbs := make([]string, 0, 0)
-	unsortedRows, err := conn.Query("SELECT thumbUrl FROM lychee_photos WHERE album = 0 ORDER BY " + s.Settings.SortingPhotos)
+
+	unsortedThumbs, err := loadThumbUrls(conn, "SELECT thumbUrl FROM lychee_photos WHERE album = 0 AND trashed = 0"+orderBy)
 	if err != nil {
 		log.Error("%v", err)
 		return
 	}
-	defer unsortedRows.Close()
-	for unsortedRows.Next() {
-		var thumbUrl string
-		unsortedRows.Scan(&thumbUrl)
-		unsortedThumbs = append(unsortedThumbs, thumbUrl)
+	r["unsorted"] = gin.H{
+		"thumbs": unsortedThumbs,
+		"num":    len(unsortedThumbs),
 	}
-	unsorted["thumbs"] = unsortedThumbs
-	unsorted["num"] = len(unsortedThumbs)
-	r["unsorted"] = unsorted
 
-	// starred
-	starred := make(map[string]interface{})
-	starredThumbs := make([]string, 0, 0)
-	starredRows, err := conn.Query("SELECT thumbUrl FROM lychee_photos WHERE star = 1 ORDER BY " + s.Settings.SortingPhotos)
+	starredThumbs, err := loadThumbUrls(conn, "SELECT thumbUrl FROM lychee_photos WHERE star = 1 AND trashed = 0"+orderBy)
 	if err != nil {
 		log.Error("%v", err)
 		return
 	}
-	defer starredRows.Close()
-	for starredRows.Next() {
-		var thumbUrl string
-		starredRows.Scan(&thumbUrl)
-		starredThumbs = append(starredThumbs, thumbUrl)
+	r["starred"] = gin.H{
+		"thumbs": starredThumbs,
+		"num":    len(starredThumbs),
 	}
 
-	starred["thumbs"] = starredThumbs
-	starred["num"] = len(starredThumbs)
-	r["starred"] = starred
-
-	publicThumbs := make([]string, 0, 0)
-	publicRows, err := conn.Query("SELECT thumbUrl From lychee_photos WHERE public = 1 ORDER BY " + s.Settings.SortingPhotos)
+	publicThumbs, err := loadThumbUrls(conn, "SELECT thumbUrl FROM lychee_photos WHERE public = 1 AND trashed = 0"+orderBy)
 	if err != nil {
 		log.Error("%v", err)
 		return
 	}
-	defer publicRows.Close()
-
 	r["public"] = gin.H{
 		"thumbs": publicThumbs,
 		"num":    len(publicThumbs),
 	}
 
-	recentThumbs := make([]string, 0, 0)
-	now := time.Now().Unix() - 24*60*60
-	recentRows, err := conn.Query("SELECT thumbUrl FROM lychee_photos WHERE id > ?", now)
+	since := helper.TimeID(time.Now().Add(-24 * time.Hour))
+	recentThumbs, err := loadThumbUrls(conn, "SELECT thumbUrl FROM lychee_photos WHERE id > ? AND trashed = 0"+orderBy, since)
 	if err != nil {
 		log.Error("%v", err)
 		return
 	}
-	defer recentRows.Close()
-	for recentRows.Next() {
-		var thumbUrl string
-		recentRows.Scan(&thumbUrl)
-		recentThumbs = append(recentThumbs, thumbUrl)
-	}
-
 	r["recent"] = gin.H{
 		"thumbs": recentThumbs,
 		"num":    len(recentThumbs),
 	}
 
+	trashThumbs, err := loadThumbUrls(conn, "SELECT thumbUrl FROM lychee_photos WHERE trashed > 0"+orderBy)
+	if err != nil {
+		log.Error("%v", err)
+		return
+	}
+	r["trash"] = gin.H{
+		"thumbs": trashThumbs,
+		"num":    len(trashThumbs),
+	}
+
 	return
 }
 
+// GetAlbumsAction lists the albums. Guests get the public albums that aren't
+// hidden, without the thumbs of those still locked by a password, and no
+// smart albums.
 func GetAlbumsAction(server *LycheeServer, c *gin.Context) {
 	conn, err := server.db.GetConnection()
 	if err != nil {
 		log.Error("%v", err)
 		c.JSON(http.StatusBadRequest, "Get albums error")
+		return
 	}
-	defer conn.Close()
-	albums, err := GetAlbums(server, conn)
+	guest := !isLoggedIn(c)
+	albums, err := GetAlbums(server, conn, guest)
 	if err != nil {
 		log.Error("%v", err)
 		c.JSON(http.StatusBadRequest, "Get albums error")
+		return
 	}
 	for _, a := range albums {
+		if guest && a.Password == "1" && !albumUnlocked(c, a.Id) {
+			a.ThumbUrls = []string{}
+			a.Sysdate = time.Unix(a.sysstamp, 0).Format("Jan 2006")
+			continue
+		}
 		a.PrepareData(server, conn)
 	}
-	smartAlbums, err := GetSmartAlbums(server, conn)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%s", err))
-		return
+	resp := gin.H{
+		"albums": albums,
+		"num":    len(albums),
 	}
-	c.JSON(200, gin.H{"albums": albums,
-		"num":         len(albums),
-		"smartalbums": smartAlbums,
-	})
+	if !guest {
+		resp["smartalbums"], err = GetSmartAlbums(server, conn)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, fmt.Sprintf("%s", err))
+			return
+		}
+	}
+	c.JSON(200, resp)
 }
 
-func GetAlbums(server *LycheeServer, conn *sql.DB) (albums []*Album, err error) {
+// GetAlbums loads the albums not hidden from the list, only the public ones
+// for guests
+func GetAlbums(server *LycheeServer, conn *sql.DB, publicOnly bool) (albums []*Album, err error) {
+	settings, err := server.GetSettings()
+	if err != nil {
+		log.Error("%v", err)
+		return
+	}
 	albums = make([]*Album, 0, 10)
-	query := "SELECT id, title, public, sysstamp FROM lychee_albums WHERE visible <> 0 " + server.Settings.SortingAlbums
+	query := "SELECT id, title, public, visible, downloadable, password, sysstamp FROM lychee_albums WHERE visible <> 0 AND trashed = 0"
+	if publicOnly {
+		query += " AND public = 1"
+	}
+	query += settings.AlbumSorting().OrderBy()
 	log.Debug("Running query: " + query)
 	rows, err := conn.Query(query)
 	if err != nil {
@@ -163,22 +195,173 @@ func GetAlbums(server *LycheeServer, conn *sql.DB) (albums []*Album, err error)
 	defer rows.Close()
 	for rows.Next() {
 		album := &Album{}
-		err = rows.Scan(&album.Id, &album.Title, &album.Public, &album.sysstamp)
+		var password sql.NullString
+		err = rows.Scan(&album.Id, &album.Title, &album.Public, &album.Visible, &album.Downloadable, &password, &album.sysstamp)
+		if err != nil {
+			return
+		}
+		album.Password = passwordFlag(password)
+		albums = append(albums, album)
+	}
+	return
+}
+
+// GetTrashedAlbums lists the albums in the trash, most recently trashed first
+func GetTrashedAlbums(conn *sql.DB) (albums []*Album, err error) {
+	albums = make([]*Album, 0)
+	rows, err := conn.Query("SELECT id, title, public, sysstamp, trashed FROM lychee_albums WHERE trashed > 0 ORDER BY trashed DESC, id DESC")
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		album := &Album{}
+		err = rows.Scan(&album.Id, &album.Title, &album.Public, &album.sysstamp, &album.Trashed)
 		if err != nil {
 			return
 		}
+		t := time.Unix(album.sysstamp, 0)
+		album.Sysdate = t.Format("Jan 2006")
 		albums = append(albums, album)
 	}
+	err = rows.Err()
 	return
 }
 
-func GetAlbum(albumID int, conn *sql.DB) (album *Album, err error) {
+func GetAlbum(albumID int64, conn *sql.DB) (album *Album, err error) {
 	album = &Album{}
-	query := "SELECT id, title, public, sysstamp FROM lychee_albums WHERE id = ? "
-	err = conn.QueryRow(query, albumID).Scan(&album.Id, &album.Title, &album.Public, &album.sysstamp)
+	var description, password sql.NullString
+	query := "SELECT id, title, description, public, visible, downloadable, password, sysstamp, trashed FROM lychee_albums WHERE id = ? "
+	err = conn.QueryRow(query, albumID).Scan(&album.Id, &album.Title, &description, &album.Public, &album.Visible,
+		&album.Downloadable, &password, &album.sysstamp, &album.Trashed)
+	album.Description = description.String
+	album.Password = passwordFlag(password)
 	return
 }
 
+// passwordFlag turns the password hash of an album into the flag the
+// frontend expects
+func passwordFlag(hash sql.NullString) string {
+	if hash.String == "" {
+		return "0"
+	}
+	return "1"
+}
+
+// formFlag reads a "1"/"0" form value as sent by the frontend
+func formFlag(c *gin.Context, key string) int {
+	if c.PostForm(key) == "1" {
+		return 1
+	}
+	return 0
+}
+
+// SetAlbumPublicAction sets who can see an album. Public albums are listed
+// for guests unless hidden, downloadable ones can be downloaded by guests and
+// a password, stored hashed, has to be entered once per session before
+// guests can open the album. Photos of public albums lose their own public
+// flag, they are visible through the album.
+func SetAlbumPublicAction(server *LycheeServer, c *gin.Context) {
+	albumID, err := strconv.ParseInt(c.PostForm("albumID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	public := formFlag(c, "public")
+	var password interface{}
+	if p := c.PostForm("password"); p != "" && public == 1 {
+		password, err = helper.HashPassword(p)
+		if err != nil {
+			log.Error("%v", err)
+			c.JSON(http.StatusInternalServerError, false)
+			return
+		}
+	}
+	conn, err := server.GetDBConnection()
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	r, err := tx.Exec("UPDATE lychee_albums SET public = ?, visible = ?, downloadable = ?, password = ? WHERE id = ?",
+		public, formFlag(c, "visible"), formFlag(c, "downloadable"), password, albumID)
+	if err == nil && public == 1 {
+		_, err = tx.Exec("UPDATE lychee_photos SET public = 0 WHERE album = ?", albumID)
+	}
+	if err != nil {
+		log.Error("%v", err)
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	if n, _ := r.RowsAffected(); n == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("Unknown album %d", albumID))
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	c.JSON(200, true)
+}
+
+// GetAlbumPublicAction checks the password of a public album and, if it's
+// right, lets the session open the album until it ends
+func GetAlbumPublicAction(server *LycheeServer, c *gin.Context) {
+	albumID, err := strconv.ParseInt(c.PostForm("albumID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	if isLoggedIn(c) {
+		c.JSON(200, true)
+		return
+	}
+	conn, err := server.GetDBConnection()
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	var public int
+	var hash sql.NullString
+	err = conn.QueryRow("SELECT public, password FROM lychee_albums WHERE id = ? AND trashed = 0", albumID).Scan(&public, &hash)
+	if err == sql.ErrNoRows || (err == nil && public != 1) {
+		c.JSON(200, false)
+		return
+	}
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	if hash.String == "" {
+		c.JSON(200, true)
+		return
+	}
+	if !helper.CheckPassword(hash.String, c.PostForm("password")) {
+		log.Warn("Wrong password for album %d from %s", albumID, c.ClientIP())
+		c.JSON(200, false)
+		return
+	}
+	err = unlockAlbum(c, albumID)
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	c.JSON(200, true)
+}
+
 func AddAlbumAction(server *LycheeServer, c *gin.Context) {
 	title := c.PostForm("title")
 	log.Info("Creating album with title " + title)
@@ -192,21 +375,22 @@ func AddAlbumAction(server *LycheeServer, c *gin.Context) {
 		c.String(http.StatusInternalServerError, "Can't connect to DB")
 		return
 	}
-	defer conn.Close()
 
-	id := helper.GenerateID()
 	sysstamp := time.Now().Unix()
 	public := 0
 	visible := 1
 
 	query := "INSERT INTO lychee_albums (id, title, sysstamp, public, visible) VALUES (?, ?, ?, ?, ?)"
 
-	_, err = conn.Exec(query, id, title, sysstamp, public, visible)
+	id, err := insertWithID(conn, "lychee_albums", helper.NextID(), func(id int64) error {
+		_, err := conn.Exec(query, id, title, sysstamp, public, visible)
+		return err
+	})
 	if err != nil {
 		c.String(http.StatusBadRequest, "Can't add album with title "+title)
 		return
 	}
-	c.String(200, id)
+	c.String(200, strconv.FormatInt(id, 10))
 }
 
 func genPhotoMap(photos []*Photo) map[int64]map[string]interface{} {
@@ -220,7 +404,7 @@ func genPhotoMap(photos []*Photo) map[int64]map[string]interface{} {
 			"tags":          p.Tags,
 			"public":        p.Public,
 			"star":          p.Star,
-			"album":         strconv.Itoa(p.Album),
+			"album":         strconv.FormatInt(p.Album, 10),
 			"thumbUrl":      p.ThumbUrl,
 			"url":           p.Url,
 			"previousPhoto": strconv.FormatInt(prev, 10),
@@ -237,7 +421,7 @@ func genPhotoMap(photos []*Photo) map[int64]map[string]interface{} {
 			}
 		} else {
 			m["cameraDate"] = "0"
-			t := time.Unix(p.ID, 0)
+			t := helper.IDTime(p.ID)
 			m["sysdate"] = t.Format("Jan 2006")
 		}
 		photoMap[p.ID] = m
@@ -246,19 +430,43 @@ func genPhotoMap(photos []*Photo) map[int64]map[string]interface{} {
 }
 
 func GetUserAlbum(albumIDStr string, conn *sql.DB, server *LycheeServer, c *gin.Context) {
-	albumID, err := strconv.Atoi(albumIDStr)
+	albumID, err := strconv.ParseInt(albumIDStr, 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
 		return
 	}
 	album, err := GetAlbum(albumID, conn)
+	if err == sql.ErrNoRows && !isLoggedIn(c) {
+		c.JSON(200, warningAlbumPrivate)
+		return
+	}
 	if err != nil {
 		log.Error("%v", err)
 		c.String(http.StatusBadRequest, fmt.Sprintf("%v", err))
 		return
 	}
+	ok, err := canOpenAlbum(conn, c, albumID)
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	if !ok {
+		if album.Public == 1 && album.Password == "1" && album.Trashed == 0 {
+			c.JSON(200, warningWrongPassword)
+		} else {
+			c.JSON(200, warningAlbumPrivate)
+		}
+		return
+	}
 	album.PrepareData(server, conn)
-	photos, err := LoadPhotosOfAlbum(albumID, conn)
+	settings, err := server.GetSettings()
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	photos, err := LoadPhotosOfAlbum(album, settings.PhotoSorting(), conn)
 	if err != nil {
 		log.Error("%v", err)
 		c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
@@ -279,26 +487,48 @@ func GetUserAlbum(albumIDStr string, conn *sql.DB, server *LycheeServer, c *gin.
 	})
 }
 
-func GetSmartAlbum(albumID string, conn *sql.DB, server *LycheeServer, c *gin.Context) {
-	var query string
-	r := map[string]interface{}{}
-	switch id := albumID; id {
+// smartAlbumTitles are the names of the smart albums
+var smartAlbumTitles = map[string]string{
+	"f": "Starred",
+	"s": "Public",
+	"r": "Recent",
+	"0": "Unsorted",
+	"t": "Trash",
+}
+
+// smartAlbumCond returns the condition on lychee_photos selecting the photos
+// of a smart album, false for unknown albums
+func smartAlbumCond(albumID string) (string, []interface{}, bool) {
+	switch albumID {
 	case "f":
-		r["public"] = "0"
-		query = PhotoSelectStmt + " WHERE star = 1"
+		return "star = 1 AND trashed = 0", nil, true
 	case "s":
-		r["public"] = "0"
-		query = PhotoSelectStmt + " WHERE public = 1"
+		return "public = 1 AND trashed = 0", nil, true
 	case "r":
-		r["public"] = "0"
-		ts := time.Now().Unix() - 24*60*60
-		query = PhotoSelectStmt + " WHERE id > " + fmt.Sprintf("%d", ts)
+		return "id > ? AND trashed = 0", []interface{}{helper.TimeID(time.Now().Add(-24 * time.Hour))}, true
 	case "0":
-		r["public"] = "0"
-		query = PhotoSelectStmt + " WHERE album = 0"
+		return "album = 0 AND trashed = 0", nil, true
+	case "t":
+		return "trashed > 0", nil, true
 	}
-	query = query + " ORDER BY " + server.Settings.SortingPhotos
-	rows, err := conn.Query(query)
+	return "", nil, false
+}
+
+func GetSmartAlbum(albumID string, conn *sql.DB, server *LycheeServer, c *gin.Context) {
+	cond, args, ok := smartAlbumCond(albumID)
+	if !ok {
+		c.JSON(http.StatusBadRequest, "Unknown album "+albumID)
+		return
+	}
+	query := PhotoSelectStmt + " WHERE " + cond
+	settings, err := server.GetSettings()
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	query = query + settings.PhotoSorting().OrderBy()
+	rows, err := conn.Query(query, args...)
 	if err != nil {
 		log.Error("%v", err)
 		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
@@ -315,19 +545,32 @@ func GetSmartAlbum(albumID string, conn *sql.DB, server *LycheeServer, c *gin.Co
 		}
 		photos = append(photos, p)
 	}
-	if len(photos) == 0 {
-		c.JSON(200, gin.H{
-			"content": false,
-		})
+	if err = rows.Err(); err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
 	}
-	photoMap := genPhotoMap(photos)
-	c.JSON(200, gin.H{
-		"content": photoMap,
-		"id":      albumID,
-		"num":     len(photos),
-	})
-
+	rows.Close()
+	resp := gin.H{
+		"content": false,
+	}
+	if len(photos) > 0 {
+		resp = gin.H{
+			"content": genPhotoMap(photos),
+			"id":      albumID,
+			"num":     len(photos),
+		}
+	}
+	if albumID == "t" {
+		albums, err := GetTrashedAlbums(conn)
+		if err != nil {
+			log.Error("%v", err)
+			c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+		resp["albums"] = albums
+	}
+	c.JSON(200, resp)
 }
 
 func GetAlbumAction(server *LycheeServer, c *gin.Context) {
@@ -339,19 +582,25 @@ func GetAlbumAction(server *LycheeServer, c *gin.Context) {
 		return
 	}
 
-	defer conn.Close()
 	if len(albumID) > 2 {
 		GetUserAlbum(albumID, conn, server, c)
-	} else {
+	} else if isLoggedIn(c) {
 		GetSmartAlbum(albumID, conn, server, c)
+	} else {
+		c.JSON(200, warningAlbumPrivate)
 	}
 }
 
 func SetAlbumTitle(conn *sql.DB, albumIDs string, title string) (interface{}, error) {
+	ids, err := ParseIDList(albumIDs)
+	if err != nil {
+		return false, err
+	}
 	if title == "" {
 		title = "Untitled"
 	}
-	_, err := conn.Exec(fmt.Sprintf("UPDATE lychee_album SET title = ? WHERE id IN (%s)", albumIDs), title)
+	in, args := inClause(ids)
+	_, err = conn.Exec("UPDATE lychee_albums SET title = ? WHERE id IN ("+in+")", append([]interface{}{title}, args...)...)
 	if err != nil {
 		log.Error("%v", err)
 		return false, err
@@ -360,7 +609,12 @@ func SetAlbumTitle(conn *sql.DB, albumIDs string, title string) (interface{}, er
 }
 
 func SetAlbumDescription(conn *sql.DB, albumIDs string, description string) (interface{}, error) {
-	_, err := conn.Exec(fmt.Sprintf("UPDATE lychee_album SET description = ? WHERE id IN (%s)", albumIDs), description)
+	ids, err := ParseIDList(albumIDs)
+	if err != nil {
+		return false, err
+	}
+	in, args := inClause(ids)
+	_, err = conn.Exec("UPDATE lychee_albums SET description = ? WHERE id IN ("+in+")", append([]interface{}{description}, args...)...)
 	if err != nil {
 		log.Error("%v", err)
 		return false, err
@@ -368,27 +622,25 @@ func SetAlbumDescription(conn *sql.DB, albumIDs string, description string) (int
 	return true, nil
 }
 
-func DeleteAlbum(conn *sql.DB, albumIDs string) (interface{}, error) {
-	tx, err := conn.Begin()
+// DeleteAlbumAction moves albums to the trash together with their photos.
+// Albums already in the trash are deleted for good.
+func DeleteAlbumAction(server *LycheeServer, c *gin.Context) {
+	ids, err := ParseIDList(c.PostForm("albumIDs"))
 	if err != nil {
-		log.Error("%v")
-		return false, err
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
 	}
-
-	_, err = tx.Exec(fmt.Sprintf("UPDATE lychee_photos SET album = 0 WHERE album in (%s)", albumIDs))
+	conn, err := server.GetDBConnection()
 	if err != nil {
-		tx.Rollback()
 		log.Error("%v", err)
-		return false, err
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
 	}
-
-	_, err = tx.Exec(fmt.Sprintf("DELETE FROM lychee_albums WHERE id in (%s)", albumIDs))
+	err = TrashAlbums(server, conn, ids)
 	if err != nil {
-		tx.Rollback()
 		log.Error("%v", err)
-		return false, err
+		c.JSON(http.StatusInternalServerError, false)
+		return
 	}
-
-	tx.Commit()
-	return true, nil
+	c.JSON(200, true)
 }
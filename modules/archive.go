@@ -0,0 +1,301 @@
+package modules
+
+import (
+	"archive/zip"
+	"database/sql"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/litao91/lychee_go/util/helper"
+	"github.com/litao91/lychee_go/util/log"
+)
+
+// Archives are written straight to the response, nothing is staged on disk.
+// Photos are stored uncompressed, JPEGs and videos wouldn't get smaller.
+
+// maxArchiveName is the longest file name, in characters, put in an archive
+const maxArchiveName = 100
+
+// uploadPrefix is the ID uploads are prefixed with in uploads/. Duplicates
+// share the files of the first upload, so it's not necessarily their own.
+var uploadPrefix = regexp.MustCompile(`^[0-9]+_`)
+
+// archivePhoto is a photo to put in an archive
+type archivePhoto struct {
+	id    int64
+	title string
+	url   string
+}
+
+// sanitizeFilename makes a title usable as a file name on any system
+func sanitizeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if r := []rune(name); len(r) > maxArchiveName {
+		name = string(r[:maxArchiveName])
+	}
+	// Windows drops trailing dots and spaces
+	return strings.Trim(name, ". ")
+}
+
+// filename returns the name of the photo in an archive: its title, or the
+// name it was uploaded with, with the extension of the original
+func (p *archivePhoto) filename() string {
+	ext := path.Ext(p.url)
+	name := p.title
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(p.url), ext)
+		if path.Dir(p.url) == "uploads" {
+			name = uploadPrefix.ReplaceAllString(name, "")
+		}
+	}
+	name = sanitizeFilename(strings.TrimSuffix(name, ext))
+	if name == "" {
+		name = strconv.FormatInt(p.id, 10)
+	}
+	return name + strings.ToLower(ext)
+}
+
+// uniqueNames gives every photo a name no other photo in the archive has,
+// ignoring case as not every file system tells them apart
+func uniqueNames(photos []*archivePhoto) []string {
+	names := make([]string, len(photos))
+	taken := map[string]bool{}
+	for i, p := range photos {
+		name := p.filename()
+		ext := path.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		for n := 2; taken[strings.ToLower(name)]; n++ {
+			name = fmt.Sprintf("%s (%d)%s", base, n, ext)
+		}
+		taken[strings.ToLower(name)] = true
+		names[i] = name
+	}
+	return names
+}
+
+// loadArchivePhotos selects the photos matching the condition
+func loadArchivePhotos(conn *sql.DB, cond string, args ...interface{}) (photos []*archivePhoto, err error) {
+	rows, err := conn.Query("SELECT id, title, url FROM lychee_photos WHERE "+cond, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p := &archivePhoto{}
+		err = rows.Scan(&p.id, &p.title, &p.url)
+		if err != nil {
+			return
+		}
+		photos = append(photos, p)
+	}
+	err = rows.Err()
+	return
+}
+
+// attachment sets the header that makes browsers save the response as name
+func attachment(c *gin.Context, name string) {
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+}
+
+// writeArchive streams the originals of the photos as a zip named title.
+// Once the first bytes are sent errors can't be reported anymore, the
+// archive is cut short and the browser fails the download.
+func (server *LycheeServer) writeArchive(c *gin.Context, title string, photos []*archivePhoto) {
+	name := sanitizeFilename(title)
+	if name == "" {
+		name = "Lychee"
+	}
+	c.Header("Content-Type", "application/zip")
+	attachment(c, name+".zip")
+	c.Status(http.StatusOK)
+
+	w := zip.NewWriter(c.Writer)
+	for i, filename := range uniqueNames(photos) {
+		file := path.Join(server.dataPath, photos[i].url)
+		if !helper.IsInsideDir(server.dataPath, file) {
+			log.Warn("Not adding %s to the archive, it's outside of %s", file, server.dataPath)
+			continue
+		}
+		err := addToArchive(w, file, filename)
+		if err != nil {
+			log.Error("%v", err)
+			if os.IsNotExist(err) {
+				continue
+			}
+			return
+		}
+	}
+	err := w.Close()
+	if err != nil {
+		log.Error("%v", err)
+	}
+}
+
+// addToArchive copies file into the archive
+func addToArchive(w *zip.Writer, file string, name string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Store
+	out, err := w.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, f)
+	return err
+}
+
+// GetAlbumArchiveAction downloads an album, or a smart album, as a zip.
+// Guests can download the albums they may open that are downloadable.
+func GetAlbumArchiveAction(server *LycheeServer, c *gin.Context) {
+	albumID := formValue(c, "albumID")
+	conn, err := server.GetDBConnection()
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, "Can't connect to DB")
+		return
+	}
+	settings, err := server.GetSettings()
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	var title, cond string
+	var args []interface{}
+	if title = smartAlbumTitles[albumID]; title != "" {
+		if !isLoggedIn(c) {
+			c.String(http.StatusForbidden, warningAlbumPrivate)
+			return
+		}
+		cond, args, _ = smartAlbumCond(albumID)
+	} else {
+		id, err := strconv.ParseInt(albumID, 10, 64)
+		if err != nil {
+			c.String(http.StatusBadRequest, fmt.Sprintf("%v", err))
+			return
+		}
+		album, err := GetAlbum(id, conn)
+		if err == sql.ErrNoRows {
+			c.String(http.StatusNotFound, "Unknown album "+albumID)
+			return
+		}
+		if err != nil {
+			log.Error("%v", err)
+			c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+		if !isLoggedIn(c) {
+			ok, err := canOpenAlbum(conn, c, id)
+			if err != nil {
+				log.Error("%v", err)
+				c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+				return
+			}
+			if !ok || album.Downloadable != 1 {
+				c.String(http.StatusForbidden, warningAlbumPrivate)
+				return
+			}
+		}
+		title = album.Title
+		cond, args = "album = ? AND trashed = ?", []interface{}{album.Id, album.Trashed}
+	}
+
+	photos, err := loadArchivePhotos(conn, cond+settings.PhotoSorting().OrderBy(), args...)
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	server.writeArchive(c, title, photos)
+}
+
+// GetPhotoArchiveAction downloads the original of a photo, several photos
+// are downloaded as a zip. Guests can download public photos and the photos
+// of downloadable albums they may open.
+func GetPhotoArchiveAction(server *LycheeServer, c *gin.Context) {
+	photoIDs := formValue(c, "photoID")
+	if photoIDs == "" {
+		photoIDs = formValue(c, "photoIDs")
+	}
+	ids, err := ParseIDList(photoIDs)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	conn, err := server.GetDBConnection()
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, "Can't connect to DB")
+		return
+	}
+	in, args := inClause(ids)
+	cond := "id IN (" + in + ")"
+	if !isLoggedIn(c) {
+		access, accessArgs := photoAccess(c)
+		cond += " AND " + access + " AND (public = 1 OR album IN (SELECT id FROM lychee_albums WHERE downloadable = 1))"
+		args = append(args, accessArgs...)
+	}
+	photos, err := loadArchivePhotos(conn, cond, args...)
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	if len(photos) == 0 {
+		c.String(http.StatusForbidden, warningPhotoPrivate)
+		return
+	}
+	if len(photos) > 1 {
+		server.writeArchive(c, "Photos", photos)
+		return
+	}
+
+	p := photos[0]
+	file := path.Join(server.dataPath, p.url)
+	if !helper.IsInsideDir(server.dataPath, file) {
+		c.String(http.StatusNotFound, "file not found")
+		return
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusNotFound, "file not found")
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	attachment(c, p.filename())
+	http.ServeContent(c.Writer, c.Request, fi.Name(), fi.ModTime(), f)
+}
@@ -2,28 +2,134 @@ package modules
 
 import (
 	"database/sql"
+	"fmt"
+	"path"
 
-	"github.com/litao91/lychee_go/sqlite_sql"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/litao91/lychee_go/schema"
+	"github.com/litao91/lychee_go/util/helper"
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// NewLycheeDb returns the library kept in the SQLite file at path
 func NewLycheeDb(path string) *LycheeDb {
 	return &LycheeDb{
-		dbPath: path,
+		dialect: sqliteDialect{},
+		source:  path,
 	}
 
 }
 
+// NewMysqlDb returns the library kept in the MySQL or MariaDB database the
+// DSN, e.g. lychee:secret@tcp(localhost:3306)/lychee, points to
+func NewMysqlDb(dsn string) *LycheeDb {
+	return &LycheeDb{
+		dialect: mysqlDialect{},
+		source:  dsn,
+	}
+}
+
+// NewDatabase returns the library of the given kind, "sqlite" for the
+// mainlib.db file in dataPath or "mysql" for the database dsn points to
+func NewDatabase(kind string, dsn string, dataPath string) (*LycheeDb, error) {
+	switch kind {
+	case "sqlite":
+		return NewLycheeDb(path.Join(dataPath, "mainlib.db")), nil
+	case "mysql":
+		if dsn == "" {
+			return nil, fmt.Errorf("a DSN is needed for the mysql database")
+		}
+		return NewMysqlDb(dsn), nil
+	}
+	return nil, fmt.Errorf("unknown database %s", kind)
+}
+
+// LycheeDb holds the single, pooled handle to the library shared by all
+// requests. Callers must not close the handle returned by GetConnection.
 type LycheeDb struct {
-	dbPath string
+	dialect Dialect
+	source  string
+	conn    *sql.DB
 }
 
+// InitDb opens the library and brings its schema up to date
 func (db *LycheeDb) InitDb() (err error) {
-	err = sqlite_sql.InitTables(db.dbPath)
+	err = db.Open()
+	if err != nil {
+		return
+	}
+	_, err = schema.Migrate(db.conn, db.dialect.Migrations())
+	if err != nil {
+		db.Close()
+	}
+	return
+}
+
+// Open opens the library without touching the schema
+func (db *LycheeDb) Open() (err error) {
+	conn, err := sql.Open(db.dialect.Driver(), db.dialect.DSN(db.source))
+	if err != nil {
+		return
+	}
+	conn.SetMaxOpenConns(db.dialect.MaxOpenConns())
+	conn.SetMaxIdleConns(db.dialect.MaxOpenConns())
+	db.conn = conn
+	return
+}
+
+// Migrate applies the pending schema migrations, returning the schema
+// version before and the migrations applied
+func (db *LycheeDb) Migrate() (from int, applied []schema.Migration, err error) {
+	conn, err := db.GetConnection()
+	if err != nil {
+		return
+	}
+	from, err = schema.CurrentVersion(conn)
+	if err != nil {
+		return
+	}
+	applied, err = schema.Migrate(conn, db.dialect.Migrations())
 	return
 }
 
+// Dialect returns what is particular to the database the library is kept in
+func (db *LycheeDb) Dialect() Dialect {
+	return db.dialect
+}
+
 func (db *LycheeDb) GetConnection() (conn *sql.DB, err error) {
-	conn, err = sql.Open("sqlite3", db.dbPath)
+	if db.conn == nil {
+		return nil, fmt.Errorf("database is not open")
+	}
+	return db.conn, nil
+}
+
+func (db *LycheeDb) Close() (err error) {
+	if db.conn == nil {
+		return
+	}
+	err = db.conn.Close()
+	db.conn = nil
 	return
 }
+
+// maxIDRetries is how often an insert is retried with a new ID
+const maxIDRetries = 5
+
+// insertWithID runs insert with id, a fresh ID from helper.NextID. IDs are
+// only unique within a process, so a bulk import running next to the server
+// can generate the same one. If the insert fails and the ID turns out to be
+// taken in table, it's retried with the next ID. The ID used is returned.
+func insertWithID(db *sql.DB, table string, id int64, insert func(id int64) error) (int64, error) {
+	for i := 0; ; i++ {
+		err := insert(id)
+		if err == nil || i == maxIDRetries {
+			return id, err
+		}
+		var count int
+		if e := db.QueryRow("SELECT COUNT(*) FROM "+table+" WHERE id = ?", id).Scan(&count); e != nil || count == 0 {
+			return id, err
+		}
+		id = helper.NextID()
+	}
+}
@@ -0,0 +1,90 @@
+package modules
+
+import (
+	"strings"
+
+	"github.com/litao91/lychee_go/mysql_sql"
+	"github.com/litao91/lychee_go/schema"
+	"github.com/litao91/lychee_go/sqlite_sql"
+)
+
+// Dialect covers what differs between the databases the library can be kept
+// in. Both drivers take ? placeholders and the queries quote the reserved
+// key column with backticks, which SQLite accepts too, so everything else is
+// shared.
+type Dialect interface {
+	// Driver is the database/sql driver name
+	Driver() string
+	// DSN adds the options the server relies on to the data source name
+	DSN(source string) string
+	MaxOpenConns() int
+	Migrations() []schema.Migration
+	// InsertIgnore starts an INSERT skipping rows whose key exists
+	InsertIgnore() string
+	// InsertReplace starts an INSERT replacing rows whose key exists
+	InsertReplace() string
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Driver() string {
+	return "sqlite3"
+}
+
+// DSN puts the library into WAL mode so readers don't block the writer,
+// waits on locks instead of failing right away, and takes the write lock
+// when a transaction begins to avoid deadlocking readers that upgrade
+func (sqliteDialect) DSN(source string) string {
+	return source + "?_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+}
+
+// MaxOpenConns is kept small, SQLite serializes writers anyway
+func (sqliteDialect) MaxOpenConns() int {
+	return 4
+}
+
+func (sqliteDialect) Migrations() []schema.Migration {
+	return sqlite_sql.Migrations
+}
+
+func (sqliteDialect) InsertIgnore() string {
+	return "INSERT OR IGNORE INTO"
+}
+
+func (sqliteDialect) InsertReplace() string {
+	return "INSERT OR REPLACE INTO"
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Driver() string {
+	return "mysql"
+}
+
+// DSN makes UPDATE report the rows it matched rather than the rows it
+// changed, the UPDATE-then-INSERT upserts depend on it
+func (mysqlDialect) DSN(source string) string {
+	if strings.Contains(source, "clientFoundRows=") {
+		return source
+	}
+	if strings.Contains(source, "?") {
+		return source + "&clientFoundRows=true"
+	}
+	return source + "?clientFoundRows=true"
+}
+
+func (mysqlDialect) MaxOpenConns() int {
+	return 16
+}
+
+func (mysqlDialect) Migrations() []schema.Migration {
+	return mysql_sql.Migrations
+}
+
+func (mysqlDialect) InsertIgnore() string {
+	return "INSERT IGNORE INTO"
+}
+
+func (mysqlDialect) InsertReplace() string {
+	return "REPLACE INTO"
+}
@@ -0,0 +1,66 @@
+package modules
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/gin-gonic/gin"
+	"github.com/litao91/lychee_go/util/helper"
+	"github.com/litao91/lychee_go/util/log"
+)
+
+// serveDataFiles serves the originals, thumbs and mediums in dir. Guests only
+// get the files of photos they may see, everything else, including private
+// photos, is answered with a 404 so they can't probe for file names.
+// Range requests, which browsers use to play videos, and conditional
+// requests are handled by http.ServeContent.
+func (server *LycheeServer) serveDataFiles(dir string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		file := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+c.Param("filepath"))))
+		if !helper.IsInsideDir(dir, file) {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		rel, err := filepath.Rel(server.dataPath, file)
+		if err != nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		conn, err := server.GetDBConnection()
+		if err != nil {
+			log.Error("%v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		ok, err := fileAccessible(conn, c, filepath.ToSlash(rel))
+		if err != nil {
+			log.Error("%v", err)
+			c.AbortWithStatus(http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		defer f.Close()
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		// whether the file may be fetched depends on the session, so shared
+		// caches must not keep it
+		c.Header("Cache-Control", "private, no-cache")
+		c.Header("ETag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()))
+		http.ServeContent(c.Writer, c.Request, fi.Name(), fi.ModTime(), f)
+	}
+}
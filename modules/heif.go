@@ -0,0 +1,71 @@
+package modules
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+
+	"github.com/jdeng/goheif/heif"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// HEIF containers are parsed in Go for EXIF. Decoding the HEVC coded pixels
+// needs libde265: builds with -tags heif (and cgo) decode in process, others
+// fall back to heif-convert from libheif if it is installed.
+
+// heifBrands are the ftyp brands of HEIF still images
+var heifBrands = map[string]bool{
+	"heic": true,
+	"heix": true,
+	"heim": true,
+	"heis": true,
+	"mif1": true,
+}
+
+// isHEIF reports whether the file starts with the ftyp box of a HEIF image
+func isHEIF(r io.ReaderAt) bool {
+	head := make([]byte, 12)
+	_, err := r.ReadAt(head, 0)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(head[4:8], []byte("ftyp")) && heifBrands[string(head[8:12])]
+}
+
+// decodeHEIF decodes a HEIF image image.Decode has no decoder for
+func decodeHEIF(imgPath string) (image.Image, error) {
+	converter, err := exec.LookPath("heif-convert")
+	if err != nil {
+		return nil, fmt.Errorf("HEIF images need a build with -tags heif or heif-convert installed")
+	}
+	out, err := ioutil.TempFile("", "lychee-heif-*.jpg")
+	if err != nil {
+		return nil, err
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+	msg, err := exec.Command(converter, "-q", "100", imgPath, out.Name()).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("heif-convert: %v: %s", err, msg)
+	}
+	f, err := os.Open(out.Name())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	return img, err
+}
+
+// heifExif returns the EXIF item of a HEIF image
+func heifExif(r io.ReaderAt) (*exif.Exif, error) {
+	raw, err := heif.Open(r).EXIF()
+	if err != nil {
+		return nil, err
+	}
+	return exif.Decode(bytes.NewReader(raw))
+}
@@ -0,0 +1,13 @@
+//go:build heif && cgo
+// +build heif,cgo
+
+package modules
+
+// goheif registers a HEIF decoder with image.Decode, bundling libde265
+import "github.com/jdeng/goheif"
+
+func init() {
+	// copy the pixels out of libde265, single tile images otherwise point
+	// into memory freed together with the decoder
+	goheif.SafeEncoding = true
+}
@@ -0,0 +1,60 @@
+package modules
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// BadRequestError marks errors caused by invalid client input, the action
+// wrappers answer them with a 400 instead of a 500
+type BadRequestError struct {
+	msg string
+}
+
+func (e *BadRequestError) Error() string {
+	return e.msg
+}
+
+func badRequest(format string, v ...interface{}) error {
+	return &BadRequestError{msg: fmt.Sprintf(format, v...)}
+}
+
+// errorStatus returns the HTTP status an action error should be answered with
+func errorStatus(err error) int {
+	if _, ok := err.(*BadRequestError); ok {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// ParseIDList parses the comma separated photoIDs/albumIDs sent by the
+// frontend, rejecting anything that isn't a list of numeric IDs
+func ParseIDList(ids string) ([]int64, error) {
+	if strings.TrimSpace(ids) == "" {
+		return nil, badRequest("no IDs given")
+	}
+	parts := strings.Split(ids, ",")
+	r := make([]int64, 0, len(parts))
+	for _, p := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(p), 10, 64)
+		if err != nil || id < 0 {
+			return nil, badRequest("invalid ID %q", p)
+		}
+		r = append(r, id)
+	}
+	return r, nil
+}
+
+// inClause returns the placeholders for an IN (...) list over ids together
+// with the matching query arguments
+func inClause(ids []int64) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(placeholders, ", "), args
+}
@@ -0,0 +1,187 @@
+package modules
+
+import (
+	"database/sql"
+	"path"
+
+	"github.com/litao91/lychee_go/util/helper"
+	"github.com/litao91/lychee_go/util/log"
+	"github.com/litao91/lychee_go/util/mysqldump"
+)
+
+// PHP Lychee keeps its files below uploads/ in big/, medium/ and thumb/, and
+// stores bare file names in url and thumbUrl and a flag in medium. The
+// importer rewrites them to the paths relative to the data directory this
+// server stores.
+
+// ImportResult counts what ImportDump added to the library
+type ImportResult struct {
+	Albums   int
+	Photos   int
+	Skipped  int
+	Settings int
+	Files    int
+}
+
+// importFile is a file of the PHP installation to copy into the data
+// directory
+type importFile struct {
+	from     string
+	to       string
+	optional bool
+}
+
+// dumpValue returns a column of a dump row, def if it is missing or NULL
+func dumpValue(row map[string]sql.NullString, column string, def string) string {
+	v, ok := row[column]
+	if !ok || !v.Valid {
+		return def
+	}
+	return v.String
+}
+
+// dumpNullable returns the value of the column, nil for NULL, empty or missing
+// values
+func dumpNullable(row map[string]sql.NullString, column string) interface{} {
+	if v := dumpValue(row, column, ""); v != "" {
+		return v
+	}
+	return nil
+}
+
+// ImportDump adds the albums, photos and settings of a PHP Lychee mysqldump
+// to the library. Rows whose id is already in the library are skipped, so
+// importing the same dump twice is harmless. If phpUploads, the uploads
+// directory of the PHP installation, is given the photo files are copied
+// into dataPath as well.
+func ImportDump(db *LycheeDb, dump *mysqldump.Dump, dataPath string, phpUploads string) (result ImportResult, err error) {
+	conn, err := db.GetConnection()
+	if err != nil {
+		return
+	}
+	tx, err := conn.Begin()
+	if err != nil {
+		return
+	}
+	files, err := importRows(tx, db.Dialect(), dump, &result)
+	if err != nil {
+		tx.Rollback()
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		return
+	}
+
+	if phpUploads == "" {
+		return
+	}
+	for _, dir := range []string{"uploads", "thumbs", "medium"} {
+		helper.CreateDirIfNotExists(path.Join(dataPath, dir))
+	}
+	for _, f := range files {
+		to := path.Join(dataPath, f.to)
+		if helper.DoesFileExists(to) {
+			continue
+		}
+		from := path.Join(phpUploads, f.from)
+		if !helper.DoesFileExists(from) {
+			if !f.optional {
+				log.Error("Missing %s", from)
+			}
+			continue
+		}
+		err = helper.CopyFile(from, to)
+		if err != nil {
+			return
+		}
+		result.Files++
+	}
+	return
+}
+
+func importRows(tx *sql.Tx, dialect Dialect, dump *mysqldump.Dump, result *ImportResult) (files []importFile, err error) {
+	if t := dump.Table("lychee_albums"); t != nil {
+		for _, row := range t.Maps() {
+			var password interface{}
+			if p := dumpValue(row, "password", ""); p != "" {
+				password = p
+			}
+			var r sql.Result
+			r, err = tx.Exec(dialect.InsertIgnore()+` lychee_albums
+				(id, title, description, sysstamp, public, visible, downloadable, password)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				dumpValue(row, "id", ""), dumpValue(row, "title", ""), dumpValue(row, "description", ""),
+				dumpValue(row, "sysstamp", "0"), dumpValue(row, "public", "0"), dumpValue(row, "visible", "1"),
+				dumpValue(row, "downloadable", "0"), password)
+			if err != nil {
+				return
+			}
+			if n, _ := r.RowsAffected(); n > 0 {
+				result.Albums++
+			} else {
+				result.Skipped++
+			}
+		}
+	}
+
+	if t := dump.Table("lychee_photos"); t != nil {
+		for _, row := range t.Maps() {
+			// only the file name is kept, the dump must not point outside
+			// of the data directory
+			url := path.Base(dumpValue(row, "url", ""))
+			thumbUrl := path.Base(dumpValue(row, "thumbUrl", ""))
+			medium := ""
+			if dumpValue(row, "medium", "0") == "1" {
+				medium = "medium/" + url
+			}
+			var r sql.Result
+			r, err = tx.Exec(dialect.InsertIgnore()+` lychee_photos
+				(id, title, description, url, tags, public, type, width, height, size, iso, aperture,
+				make, model, shutter, focal, takestamp, star, thumbUrl, album, checksum, medium,
+				latitude, longitude, altitude, imgDirection, lens)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+				dumpValue(row, "id", ""), dumpValue(row, "title", ""), dumpValue(row, "description", ""),
+				"uploads/"+url, dumpValue(row, "tags", ""), dumpValue(row, "public", "0"),
+				dumpValue(row, "type", ""), dumpValue(row, "width", "0"), dumpValue(row, "height", "0"),
+				dumpValue(row, "size", ""), dumpValue(row, "iso", ""), dumpValue(row, "aperture", ""),
+				dumpValue(row, "make", ""), dumpValue(row, "model", ""), dumpValue(row, "shutter", ""),
+				dumpValue(row, "focal", ""), dumpNullable(row, "takestamp"), dumpValue(row, "star", "0"),
+				"thumbs/"+thumbUrl, dumpValue(row, "album", "0"), dumpValue(row, "checksum", ""), medium,
+				// newer PHP versions keep the position and lens too
+				dumpNullable(row, "latitude"), dumpNullable(row, "longitude"), dumpNullable(row, "altitude"),
+				dumpNullable(row, "imgDirection"), dumpValue(row, "lens", ""))
+			if err != nil {
+				return
+			}
+			if n, _ := r.RowsAffected(); n == 0 {
+				result.Skipped++
+				continue
+			}
+			result.Photos++
+			files = append(files,
+				importFile{from: "big/" + url, to: "uploads/" + url},
+				importFile{from: "thumb/" + thumbUrl, to: "thumbs/" + thumbUrl},
+				importFile{from: "thumb/" + path.Base(thumb2xPath(thumbUrl)), to: thumb2xPath("thumbs/" + thumbUrl), optional: true})
+			if medium != "" {
+				files = append(files, importFile{from: "medium/" + url, to: medium})
+			}
+		}
+	}
+
+	if t := dump.Table("lychee_settings"); t != nil {
+		for _, row := range t.Maps() {
+			key := dumpValue(row, "key", "")
+			// the version is ours and keys we don't know are of no use
+			if _, ok := defaultSettings[key]; !ok {
+				continue
+			}
+			_, err = tx.Exec(dialect.InsertReplace()+" lychee_settings (`key`, value) VALUES (?, ?)", key, dumpValue(row, "value", ""))
+			if err != nil {
+				return
+			}
+			result.Settings++
+		}
+	}
+	return
+}
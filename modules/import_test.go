@@ -0,0 +1,75 @@
+package modules
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/litao91/lychee_go/util/mysqldump"
+)
+
+const phpDump = "INSERT INTO `lychee_lychee_albums` (`id`, `title`, `sysstamp`, `public`, `visible`, `downloadable`, `password`) VALUES " +
+	"(14000000000000,'Holidays',1400000000,1,1,0,NULL);\n" +
+	"INSERT INTO `lychee_lychee_photos` (`id`, `title`, `url`, `thumbUrl`, `album`, `checksum`, `medium`, `takestamp`, `latitude`) VALUES " +
+	"(14000000000001,'Beach','abc.jpg','abc.jpeg',14000000000000,'0123',1,NULL,'-33.5')," +
+	"(14000000000002,'Sunset','def.jpg','def.jpeg',14000000000000,'4567',0,1400000000,NULL);\n" +
+	"INSERT INTO `lychee_lychee_settings` (`key`, `value`) VALUES ('lang','de'),('version','030102');\n"
+
+func TestImportDumpSkipsExistingRows(t *testing.T) {
+	db := NewLycheeDb(filepath.Join(t.TempDir(), "mainlib.db"))
+	if err := db.InitDb(); err != nil {
+		t.Fatalf("InitDb: %v", err)
+	}
+	defer db.Close()
+	dump, err := mysqldump.Parse(strings.NewReader(phpDump))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	r, err := ImportDump(db, dump, "", "")
+	if err != nil {
+		t.Fatalf("ImportDump: %v", err)
+	}
+	if want := (ImportResult{Albums: 1, Photos: 2, Settings: 1}); r != want {
+		t.Errorf("first import = %+v, want %+v", r, want)
+	}
+
+	conn, _ := db.GetConnection()
+	var url, medium string
+	err = conn.QueryRow("SELECT url, medium FROM lychee_photos WHERE id = ?", 14000000000001).Scan(&url, &medium)
+	if err != nil {
+		t.Fatalf("imported photo: %v", err)
+	}
+	if url != "uploads/abc.jpg" || medium != "medium/abc.jpg" {
+		t.Errorf("url, medium = %q, %q, want uploads/abc.jpg, medium/abc.jpg", url, medium)
+	}
+
+	// rows edited since the first import must be left alone
+	_, err = conn.Exec("UPDATE lychee_photos SET title = 'Renamed' WHERE id = ?", 14000000000001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err = ImportDump(db, dump, "", "")
+	if err != nil {
+		t.Fatalf("second ImportDump: %v", err)
+	}
+	if r.Albums != 0 || r.Photos != 0 || r.Skipped != 3 {
+		t.Errorf("second import = %+v, want 3 rows skipped and nothing added", r)
+	}
+	var title string
+	var count int
+	err = conn.QueryRow("SELECT title FROM lychee_photos WHERE id = ?", 14000000000001).Scan(&title)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title != "Renamed" {
+		t.Errorf("title = %q, the existing row was overwritten", title)
+	}
+	err = conn.QueryRow("SELECT COUNT(*) FROM lychee_photos").Scan(&count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("%d photos in the library, want 2", count)
+	}
+}
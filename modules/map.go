@@ -0,0 +1,242 @@
+package modules
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/litao91/lychee_go/util/log"
+)
+
+// The map gets the photos with a position as GeoJSON. Unless zoomed in all
+// the way, photos close to each other on screen are merged into one feature
+// with a count, so large libraries don't send a point per photo.
+
+const (
+	// maxZoom is the zoom level from which photos are never clustered
+	maxZoom = 20
+	// defaultZoom is used when the client doesn't send its zoom level, it
+	// shows the whole world in a few features
+	defaultZoom = 3
+	// tileSize is the size in pixels of a map tile at any zoom level
+	tileSize = 256
+	// clusterSize is the size in pixels of a cluster cell on screen
+	clusterSize = 64
+	// maxLatitude is as far north and south as web mercator maps go
+	maxLatitude = 85.05112878
+)
+
+// FeatureCollection is a GeoJSON feature collection
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+// Feature is a GeoJSON point feature for a photo or a cluster of photos
+type Feature struct {
+	Type       string            `json:"type"`
+	Geometry   Geometry          `json:"geometry"`
+	Properties FeatureProperties `json:"properties"`
+	// Bbox spans the photos of a cluster, the map zooms to it on click
+	Bbox []float64 `json:"bbox,omitempty"`
+}
+
+// Geometry is a GeoJSON point, coordinates are longitude then latitude
+type Geometry struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// FeatureProperties describes the photos of a feature. A cluster shows the
+// thumb of its first photo in sort order.
+type FeatureProperties struct {
+	Count     int    `json:"count"`
+	PhotoID   string `json:"photoID"`
+	Album     string `json:"album"`
+	Title     string `json:"title"`
+	ThumbUrl  string `json:"thumbUrl"`
+	Takestamp string `json:"takestamp"`
+}
+
+// cluster collects the photos of a grid cell
+type cluster struct {
+	feature        *Feature
+	sumLat, sumLon float64
+}
+
+// mapCell returns the grid cell the position falls in at the zoom level,
+// using the web mercator projection of the map
+func mapCell(lat float64, lon float64, zoom int) (int64, int64) {
+	lat = math.Max(-maxLatitude, math.Min(maxLatitude, lat))
+	scale := tileSize * math.Exp2(float64(zoom)) / clusterSize
+	x := (lon + 180) / 360 * scale
+	r := lat * math.Pi / 180
+	y := (1 - math.Log(math.Tan(r)+1/math.Cos(r))/math.Pi) / 2 * scale
+	return int64(x), int64(y)
+}
+
+// parseZoom parses the zoom level of the map, defaultZoom if none is given
+func parseZoom(s string) (int, error) {
+	if s == "" {
+		return defaultZoom, nil
+	}
+	zoom, err := strconv.Atoi(s)
+	if err != nil || zoom < 0 || zoom > maxZoom {
+		return 0, badRequest("invalid zoom %q", s)
+	}
+	return zoom, nil
+}
+
+// parseBbox parses a "west,south,east,north" bounding box. West is larger
+// than east for boxes crossing the antimeridian.
+func parseBbox(s string) (bbox []float64, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, badRequest("invalid bbox %q", s)
+	}
+	for _, p := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil || math.IsNaN(v) {
+			return nil, badRequest("invalid bbox %q", s)
+		}
+		bbox = append(bbox, v)
+	}
+	if bbox[1] > bbox[3] {
+		return nil, badRequest("invalid bbox %q, south lies north of north", s)
+	}
+	return bbox, nil
+}
+
+// LoadPositionData returns the photos with a position matching the condition
+// as GeoJSON, clustered for the zoom level
+func LoadPositionData(conn *sql.DB, sorting Sorting, zoom int, bbox []float64, cond string, args ...interface{}) (*FeatureCollection, error) {
+	query := `SELECT id, album, title, thumbUrl, takestamp, latitude, longitude FROM lychee_photos
+		WHERE latitude IS NOT NULL AND longitude IS NOT NULL AND trashed = 0 AND ` + cond
+	if bbox != nil {
+		query += " AND latitude BETWEEN ? AND ?"
+		args = append(args, bbox[1], bbox[3])
+		if bbox[0] <= bbox[2] {
+			query += " AND longitude BETWEEN ? AND ?"
+		} else {
+			query += " AND (longitude >= ? OR longitude <= ?)"
+		}
+		args = append(args, bbox[0], bbox[2])
+	}
+	rows, err := conn.Query(query+sorting.OrderBy(), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collection := &FeatureCollection{Type: "FeatureCollection", Features: []*Feature{}}
+	cells := map[[2]int64]*cluster{}
+	clusters := []*cluster{}
+	for rows.Next() {
+		var id, album int64
+		var title, thumbUrl string
+		var takestamp sql.NullString
+		var lat, lon float64
+		err = rows.Scan(&id, &album, &title, &thumbUrl, &takestamp, &lat, &lon)
+		if err != nil {
+			return nil, err
+		}
+		key := [2]int64{id, 0}
+		if zoom < maxZoom {
+			x, y := mapCell(lat, lon, zoom)
+			key = [2]int64{x, y}
+		}
+		cl, ok := cells[key]
+		if !ok {
+			cl = &cluster{feature: &Feature{
+				Type:     "Feature",
+				Geometry: Geometry{Type: "Point"},
+				Properties: FeatureProperties{
+					PhotoID:   strconv.FormatInt(id, 10),
+					Album:     strconv.FormatInt(album, 10),
+					Title:     title,
+					ThumbUrl:  thumbUrl,
+					Takestamp: takestamp.String,
+				},
+				Bbox: []float64{lon, lat, lon, lat},
+			}}
+			cells[key] = cl
+			clusters = append(clusters, cl)
+		}
+		f := cl.feature
+		f.Properties.Count++
+		cl.sumLat += lat
+		cl.sumLon += lon
+		f.Bbox = []float64{math.Min(f.Bbox[0], lon), math.Min(f.Bbox[1], lat), math.Max(f.Bbox[2], lon), math.Max(f.Bbox[3], lat)}
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cl := range clusters {
+		f := cl.feature
+		n := float64(f.Properties.Count)
+		f.Geometry.Coordinates = [2]float64{cl.sumLon / n, cl.sumLat / n}
+		if f.Properties.Count == 1 {
+			f.Bbox = nil
+		}
+		collection.Features = append(collection.Features, f)
+	}
+	return collection, nil
+}
+
+// GetPositionDataAction answers Albums::getPositionData with the photos of
+// the whole library and Album::getPositionData with those of one album. The
+// optional zoom is the zoom level of the map, without it the photos are
+// clustered as for the whole world. bbox limits the photos to the part of
+// the map on screen.
+func GetPositionDataAction(server *LycheeServer, c *gin.Context) {
+	zoom, err := parseZoom(c.PostForm("zoom"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	var bbox []float64
+	if b := c.PostForm("bbox"); b != "" {
+		bbox, err = parseBbox(b)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+			return
+		}
+	}
+
+	cond, args := photoAccess(c)
+	if albumID := c.PostForm("albumID"); albumID != "" {
+		id, err := strconv.ParseInt(albumID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+			return
+		}
+		cond += " AND album = ?"
+		args = append(args, id)
+	}
+
+	conn, err := server.GetDBConnection()
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	settings, err := server.GetSettings()
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	collection, err := LoadPositionData(conn, settings.PhotoSorting(), zoom, bbox, cond, args...)
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	c.JSON(200, collection)
+}
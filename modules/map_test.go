@@ -0,0 +1,69 @@
+package modules
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// positionData asks the server for the positions of the library as a guest
+func positionData(t *testing.T, server *LycheeServer, form url.Values) *FeatureCollection {
+	form.Set("function", "Albums::getPositionData")
+	req := httptest.NewRequest("POST", "/php/index.php", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	collection := &FeatureCollection{}
+	if err := json.Unmarshal(w.Body.Bytes(), collection); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	return collection
+}
+
+func TestGetPositionDataWithoutZoom(t *testing.T) {
+	server := NewServer(t.TempDir(), t.TempDir(), 0)
+	if err := server.Init(); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	defer server.Close()
+	conn, _ := server.GetDBConnection()
+	positions := []struct {
+		id       int64
+		lat, lon float64
+	}{
+		{1, 52.5200, 13.4050},   // Berlin
+		{2, 52.3906, 13.0645},   // Potsdam
+		{3, -33.8688, 151.2093}, // Sydney
+	}
+	for _, p := range positions {
+		lat, lon := p.lat, p.lon
+		photo := &Photo{ID: p.id, Url: "uploads/a.jpg", Public: "1", Star: "0", Latitude: &lat, Longitude: &lon}
+		if err := photo.SavePhotoMeta(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// without a zoom level the photos are clustered for the whole world
+	collection := positionData(t, server, url.Values{})
+	if len(collection.Features) != 2 {
+		t.Fatalf("got %d features without zoom, want 2 clusters", len(collection.Features))
+	}
+	counts := map[int]int{}
+	for _, f := range collection.Features {
+		counts[f.Properties.Count]++
+	}
+	if counts[1] != 1 || counts[2] != 1 {
+		t.Errorf("cluster sizes %v, want one of 2 and one of 1", counts)
+	}
+
+	collection = positionData(t, server, url.Values{"zoom": {"20"}})
+	if len(collection.Features) != 3 {
+		t.Errorf("got %d features at zoom 20, want a point per photo", len(collection.Features))
+	}
+}
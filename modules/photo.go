@@ -4,7 +4,11 @@ import (
 	"database/sql"
 	"fmt"
 	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
 	"image/jpeg"
+	_ "image/png"
 	"io"
 	"net/http"
 	"os"
@@ -20,14 +24,36 @@ import (
 	"github.com/litao91/lychee_go/util/helper"
 	"github.com/litao91/lychee_go/util/log"
 	"github.com/rwcarlsen/goexif/exif"
+	_ "golang.org/x/image/webp"
 )
 
 const ImageTypeJpg = 0
 
+// imageExtensions lists the extensions accepted for upload and import
+var imageExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".gif":  true,
+	".webp": true,
+	".heic": true,
+	".heif": true,
+}
+
+// imageTypes maps the formats image.Decode reports to their MIME type
+var imageTypes = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"heic": "image/heic",
+}
+
 const PhotoSelectStmt string = `
 SELECT id, title, description, url, tags,
 public, type, width, height, size, iso, aperture, make, model,
-shutter, focal, takestamp, star, thumbUrl, album, checksum, medium
+shutter, focal, takestamp, star, thumbUrl, album, checksum, medium,
+latitude, longitude, altitude, imgDirection, lens, exposureBias
 FROM lychee_photos`
 
 type Photo struct {
@@ -51,10 +77,17 @@ type Photo struct {
 	Takedate    string `json:"takedate"`
 	Star        string `json:"star"`
 	ThumbUrl    string `json:"thumbUrl"`
-	Album       int    `json:"album"`
+	Album       int64  `json:"album"`
 	Checksum    string `json:"checksum"`
 	Medium      string `json:"medium"`
 
+	Latitude     *float64 `json:"latitude"`
+	Longitude    *float64 `json:"longitude"`
+	Altitude     *float64 `json:"altitude"`
+	ImgDirection *float64 `json:"imgDirection"`
+	Lens         string   `json:"lens"`
+	ExposureBias string   `json:"exposureBias"`
+
 	idStr       string
 	filename    string
 	dataPath    string
@@ -65,6 +98,8 @@ type Photo struct {
 	thumb2xPath string
 	tempPath    string
 	img         image.Image
+	video       *videoInfo
+	settings    *Settings
 }
 
 func NewPhoto(server *LycheeServer, imgPath string, filename string, idStr string) (photo *Photo, err error) {
@@ -74,6 +109,13 @@ func NewPhoto(server *LycheeServer, imgPath string, filename string, idStr strin
 		imagePath: imgPath,
 		filename:  filename,
 		Public:    "0",
+		Star:      "0",
+	}
+
+	photo.settings, err = server.GetSettings()
+	if err != nil {
+		log.Error("%v", err)
+		return
 	}
 
 	photo.ID, err = strconv.ParseInt(photo.idStr, 10, 64)
@@ -94,18 +136,51 @@ func NewPhoto(server *LycheeServer, imgPath string, filename string, idStr strin
 		return
 	}
 	defer file.Close()
-	img, format, err := image.Decode(file)
+	var img image.Image
+	// heif-convert applies the rotation of the container already, the
+	// in-process HEIF decoder returns the image as it's coded
+	converted := false
+	ext := strings.ToLower(path.Ext(filename))
+	if rawType, ok := rawTypes[ext]; ok {
+		img, err = rawPreview(file)
+		photo.Type = rawType
+	} else if videoType, ok := videoTypes[ext]; ok {
+		photo.video = &videoInfo{}
+		if videoType != "video/webm" {
+			info, e := parseMP4(file)
+			if e != nil {
+				// the poster frame may still be extracted
+				log.Error("%v", e)
+			}
+			photo.video = &info
+		}
+		img = videoPoster(imgPath, *photo.video)
+		photo.Type = videoType
+	} else {
+		var format string
+		img, format, err = image.Decode(file)
+		if err == image.ErrFormat && isHEIF(file) {
+			img, err = decodeHEIF(imgPath)
+			format = "heic"
+			converted = true
+		}
+		photo.Type = imageTypes[format]
+	}
 	if err != nil {
 		log.Error("%v", err)
+		return
+	}
+	if photo.video == nil && !converted {
+		img = orient(img, exifOrientation(file))
 	}
 
-	photo.img = img
-	photo.Type = format
+	// thumbs and mediums are JPEG, which can't hold transparency
+	photo.img = flatten(img)
 
 	photo.Checksum = checksum
 
 	photo.thumbPath = path.Join(server.thumbsDir, checksum+".jpg")
-	photo.thumb2xPath = path.Join(server.thumbsDir, checksum+"@2x.jpg")
+	photo.thumb2xPath = thumb2xPath(photo.thumbPath)
 	photo.uploadPath = path.Join(server.uploadsDir, photo.idStr+"_"+filename)
 
 	photo.mediumPath = path.Join(server.mediumDir, checksum+".jpg")
@@ -113,9 +188,11 @@ func NewPhoto(server *LycheeServer, imgPath string, filename string, idStr strin
 	return
 }
 
-func LoadPhotosOfAlbum(albumID int, conn *sql.DB) (photos []*Photo, err error) {
-	query := PhotoSelectStmt + " WHERE album = ?"
-	rows, err := conn.Query(query, albumID)
+// LoadPhotosOfAlbum returns the photos of the album. For an album in the
+// trash these are the photos trashed together with it.
+func LoadPhotosOfAlbum(album *Album, sorting Sorting, conn *sql.DB) (photos []*Photo, err error) {
+	query := PhotoSelectStmt + " WHERE album = ? AND trashed = ?" + sorting.OrderBy()
+	rows, err := conn.Query(query, album.Id, album.Trashed)
 	if err != nil {
 		log.Error("%v", err)
 		return
@@ -131,14 +208,27 @@ func LoadPhotosOfAlbum(albumID int, conn *sql.DB) (photos []*Photo, err error) {
 		}
 		photos = append(photos, r)
 	}
+	err = rows.Err()
+	if err != nil {
+		log.Error("%v", err)
+	}
 	return
 }
 
-func loadPhotoFromRow(row *sql.Rows) (r *Photo, err error) {
+// rowScanner is either *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// loadPhotoFromRow scans a row selected with PhotoSelectStmt
+func loadPhotoFromRow(row rowScanner) (r *Photo, err error) {
 	r = &Photo{}
+	var takestamp sql.NullString
 	err = row.Scan(&r.ID, &r.Title, &r.Description, &r.Url, &r.Tags, &r.Public, &r.Type, &r.Width, &r.Height,
-		&r.Size, &r.Iso, &r.Aperture, &r.Make, &r.Model, &r.Shutter, &r.Focal, &r.Takestamp, &r.Star,
-		&r.ThumbUrl, &r.Album, &r.Checksum, &r.Medium)
+		&r.Size, &r.Iso, &r.Aperture, &r.Make, &r.Model, &r.Shutter, &r.Focal, &takestamp, &r.Star,
+		&r.ThumbUrl, &r.Album, &r.Checksum, &r.Medium,
+		&r.Latitude, &r.Longitude, &r.Altitude, &r.ImgDirection, &r.Lens, &r.ExposureBias)
+	r.Takestamp = takestamp.String
 	return
 }
 
@@ -151,25 +241,92 @@ func (photo *Photo) Exists(db *sql.DB) (bool, error) {
 	return count > 0, nil
 }
 
-func validateExtension(filename string) (string, bool) {
-	isValid := strings.HasSuffix(strings.ToLower(filename), ".jpg")
-	return "jpg", isValid
+// SupportedFile reports whether files with the extension of filename can be
+// added to the library
+func SupportedFile(filename string) bool {
+	ext := strings.ToLower(path.Ext(filename))
+	_, raw := rawTypes[ext]
+	_, video := videoTypes[ext]
+	return imageExtensions[ext] || raw || video
+}
+
+// exifOrientation returns the EXIF Orientation of the file, 1 if it has none
+func exifOrientation(f *os.File) int {
+	_, err := f.Seek(0, io.SeekStart)
+	if err != nil {
+		return 1
+	}
+	var x *exif.Exif
+	if isHEIF(f) {
+		x, err = heifExif(f)
+	} else {
+		x, err = exif.Decode(f)
+	}
+	if err != nil {
+		return 1
+	}
+	tag, err := x.Get(exif.Orientation)
+	if err != nil {
+		return 1
+	}
+	o, err := tag.Int(0)
+	if err != nil {
+		return 1
+	}
+	return o
+}
+
+// orient rotates and flips img the way the EXIF Orientation says it should
+// be shown
+func orient(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// flatten draws images that may be transparent onto white. Only the first
+// frame of an animated GIF is decoded, the original keeps the animation.
+func flatten(img image.Image) image.Image {
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		return img
+	}
+	b := img.Bounds()
+	flat := image.NewRGBA(b)
+	draw.Draw(flat, b, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, b, img, b.Min, draw.Over)
+	return flat
 }
 
 func GetPhotoAction(server *LycheeServer, c *gin.Context) {
 	photoId := c.PostForm("photoID")
 	log.Debug("ID: " + photoId)
-	r := &Photo{}
-	query := PhotoSelectStmt + " WHERE id = ?"
+	cond, args := photoAccess(c)
+	query := PhotoSelectStmt + " WHERE id = ? AND " + cond
 	conn, err := server.db.GetConnection()
 	if err != nil {
 		log.Error("%v", err)
 		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
 	}
-	err = conn.QueryRow(query, photoId).Scan(&r.ID, &r.Title, &r.Description, &r.Url, &r.Tags, &r.Public, &r.Type, &r.Width, &r.Height,
-		&r.Size, &r.Iso, &r.Aperture, &r.Make, &r.Model, &r.Shutter, &r.Focal, &r.Takestamp, &r.Star,
-		&r.ThumbUrl, &r.Album, &r.Checksum, &r.Medium)
+	r, err := loadPhotoFromRow(conn.QueryRow(query, append([]interface{}{photoId}, args...)...))
+	if err == sql.ErrNoRows && !isLoggedIn(c) {
+		c.JSON(200, warningPhotoPrivate)
+		return
+	}
 	if err != nil {
 		log.Error("%v", err)
 		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
@@ -188,20 +345,23 @@ func GetPhotoAction(server *LycheeServer, c *gin.Context) {
 }
 
 func SetPhotoAlbumAction(server *LycheeServer, c *gin.Context) {
-	conn, err := server.GetDBConnection()
+	ids, err := ParseIDList(c.PostForm("photoIDs"))
 	if err != nil {
-		c.JSON(500, fmt.Sprintf("%v", err))
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
 		return
 	}
-	defer conn.Close()
-	photoIds := c.PostForm("photoIDs")
-	albumId := c.PostForm("albumID")
+	albumId, err := strconv.ParseInt(c.PostForm("albumID"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	conn, err := server.GetDBConnection()
 	if err != nil {
-		log.Error("%v", err)
 		c.JSON(500, fmt.Sprintf("%v", err))
 		return
 	}
-	_, err = conn.Exec(fmt.Sprintf("Update lychee_photos SET album = ? WHERE ID IN (%s)", photoIds), albumId)
+	in, args := inClause(ids)
+	_, err = conn.Exec("UPDATE lychee_photos SET album = ? WHERE id IN ("+in+")", append([]interface{}{albumId}, args...)...)
 	if err != nil {
 		log.Error("%v", err)
 		c.JSON(200, false)
@@ -213,21 +373,26 @@ func SetPhotoAlbumAction(server *LycheeServer, c *gin.Context) {
 
 func SetStar(db *sql.DB, photoIDs string) (interface{}, error) {
 	log.Debug("Star for %s", photoIDs)
-	query := fmt.Sprintf("SELECT id, star FROM lychee_photos WHERE id in (%s)", photoIDs)
-	rows, err := db.Query(query)
+	ids, err := ParseIDList(photoIDs)
+	if err != nil {
+		return false, err
+	}
+	in, args := inClause(ids)
+	rows, err := db.Query("SELECT id, star FROM lychee_photos WHERE id IN ("+in+")", args...)
 	if err != nil {
 		log.Error("%v", err)
 		return false, err
 	}
 	defer rows.Close()
 
-	idStar := [][]int{}
+	idStar := [][]int64{}
 	for rows.Next() {
-		var id, star int
+		var id, star int64
 		rows.Scan(&id, &star)
 		log.Debug("%d - %d", id, star)
-		idStar = append(idStar, []int{id, star})
+		idStar = append(idStar, []int64{id, star})
 	}
+	rows.Close()
 	tx, err := db.Begin()
 	if err != nil {
 		log.Error("%v", err)
@@ -242,81 +407,168 @@ func SetStar(db *sql.DB, photoIDs string) (interface{}, error) {
 		}
 	}
 
-	tx.Commit()
+	err = tx.Commit()
+	if err != nil {
+		log.Error("%v", err)
+		return false, err
+	}
 	return true, nil
 }
 
-func SetPhotoTitle(db *sql.DB, photoIDs string, title string) (interface{}, error) {
-	_, err := db.Exec(fmt.Sprintf("UPDATE lychee_photos SET title = ? WHERE id in (%s)", photoIDs), title)
+// setPhotoColumn sets column to value for every photo in photoIDs. column
+// must never come from the client.
+func setPhotoColumn(db *sql.DB, photoIDs string, column string, value interface{}) (interface{}, error) {
+	ids, err := ParseIDList(photoIDs)
+	if err != nil {
+		return false, err
+	}
+	in, args := inClause(ids)
+	_, err = db.Exec("UPDATE lychee_photos SET "+column+" = ? WHERE id IN ("+in+")", append([]interface{}{value}, args...)...)
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
+func SetPhotoTitle(db *sql.DB, photoIDs string, title string) (interface{}, error) {
+	return setPhotoColumn(db, photoIDs, "title", title)
+}
+
 func SetPhotoDescription(db *sql.DB, photoIDs string, description string) (interface{}, error) {
 	log.Debug("Set description of %s to %s", photoIDs, description)
-	_, err := db.Exec(fmt.Sprintf("UPDATE lychee_photos SET description = ? WHERE id in (%s)", photoIDs), description)
-	if err != nil {
-		return false, err
-	}
-	return true, nil
+	return setPhotoColumn(db, photoIDs, "description", description)
 }
 
 func SetPhotoTags(db *sql.DB, photoIDs string, tags string) (interface{}, error) {
-	_, err := db.Exec(fmt.Sprintf("UPDATE lychee_photos SET tags = ? WHERE id in (%s)", photoIDs), tags)
-	if err != nil {
-		return false, err
-	}
-	return true, nil
+	return setPhotoColumn(db, photoIDs, "tags", tags)
 }
 
+// DeletePhotoAction moves photos to the trash, photos already in the trash
+// are deleted for good
 func DeletePhotoAction(server *LycheeServer, c *gin.Context) {
-	photoIDs := c.PostForm("photoIDs")
+	ids, err := ParseIDList(c.PostForm("photoIDs"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
 	db, err := server.GetDBConnection()
 	if err != nil {
 		log.Error("%v", err)
 		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
 		return
 	}
-	query := fmt.Sprintf("SELECT url, thumbUrl, medium FROM lychee_photos WHERE id in (%s)", photoIDs)
-	rows, err := db.Query(query)
+	err = TrashPhotos(server, db, ids)
 	if err != nil {
 		log.Error("%v", err)
-		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		c.JSON(500, false)
 		return
 	}
-	defer rows.Close()
+
+	c.JSON(200, true)
+}
+
+// photoFiles are the paths, relative to the data directory, of the files
+// belonging to a photo row
+type photoFiles struct {
+	url      string
+	thumbUrl string
+	medium   string
+	checksum string
+}
+
+// DeletePhotos removes the photo rows and then every file no remaining row
+// refers to
+func DeletePhotos(server *LycheeServer, db *sql.DB, ids []int64) error {
+	in, args := inClause(ids)
+	rows, err := db.Query("SELECT url, thumbUrl, medium, checksum FROM lychee_photos WHERE id IN ("+in+")", args...)
+	if err != nil {
+		return err
+	}
+	files := []photoFiles{}
 	for rows.Next() {
-		var url, thumbUrl, medium string
-		err := rows.Scan(&url, &thumbUrl, &medium)
+		var f photoFiles
+		var checksum sql.NullString
+		err = rows.Scan(&f.url, &f.thumbUrl, &f.medium, &checksum)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		f.checksum = checksum.String
+		files = append(files, f)
+	}
+	rows.Close()
+
+	_, err = db.Exec("DELETE FROM lychee_photos WHERE id IN ("+in+")", args...)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM lychee_shares WHERE photo IN ("+in+")", args...)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		err = server.removePhotoFiles(db, f)
 		if err != nil {
 			log.Error("%v", err)
-			c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
-			return
 		}
-		img := path.Join(server.dataPath, url)
-		thumb := path.Join(server.dataPath, thumbUrl)
-		splitted := strings.Split(thumb, ".")
-		thumb2x := splitted[0] + "@2x" + splitted[1]
-		m := path.Join(server.dataPath, medium)
-		log.Debug("Deleting %s, %s, %s, %s", img, thumb, thumb2x, m)
-		log.Debug("DOn't do real deletion for now")
 	}
+	return nil
+}
 
-	query = fmt.Sprintf("DELETE from lychee_photos WHERE id in (%s)", photoIDs)
-	_, err = db.Exec(query)
+// removePhotoFiles deletes the original, thumbs and medium of a deleted row.
+// Files are shared between rows with the same checksum, so nothing is
+// deleted while another row still refers to them. Originals outside the
+// uploads directory were imported in place and are never deleted.
+func (server *LycheeServer) removePhotoFiles(db *sql.DB, f photoFiles) error {
+	query := "SELECT COUNT(*) FROM lychee_photos WHERE url = ? OR thumbUrl = ?"
+	args := []interface{}{f.url, f.thumbUrl}
+	if f.checksum != "" {
+		query += " OR checksum = ?"
+		args = append(args, f.checksum)
+	}
+	var count int
+	err := db.QueryRow(query, args...).Scan(&count)
 	if err != nil {
-		log.Error("%v", err)
-		c.JSON(500, false)
-		return
+		return err
+	}
+	if count > 0 {
+		log.Debug("Files of %s still in use, keeping them", f.url)
+		return nil
 	}
 
-	c.JSON(200, true)
+	if f.thumbUrl != "" {
+		thumb := path.Join(server.dataPath, f.thumbUrl)
+		removeFileInside(server.thumbsDir, thumb)
+		removeFileInside(server.thumbsDir, thumb2xPath(thumb))
+	}
+	if f.medium != "" {
+		removeFileInside(server.mediumDir, path.Join(server.dataPath, f.medium))
+	}
+	removeFileInside(server.uploadsDir, path.Join(server.dataPath, f.url))
+	return nil
+}
+
+// thumb2xPath returns the path of the @2x version of a thumb
+func thumb2xPath(thumb string) string {
+	ext := path.Ext(thumb)
+	return strings.TrimSuffix(thumb, ext) + "@2x" + ext
+}
+
+// removeFileInside deletes file, but only if it lies within dir
+func removeFileInside(dir string, file string) {
+	if !helper.IsInsideDir(dir, file) {
+		log.Debug("Not deleting %s, it's outside of %s", file, dir)
+		return
+	}
+	log.Debug("Deleting %s", file)
+	err := os.Remove(file)
+	if err != nil && !os.IsNotExist(err) {
+		log.Error("%v", err)
+	}
 }
 
 func UploadAction(server *LycheeServer, c *gin.Context) {
-	albumId, err := strconv.Atoi(c.PostForm("albumID"))
+	albumId, err := strconv.ParseInt(c.PostForm("albumID"), 10, 64)
 	log.Debug("Uploading image to album: %d", albumId)
 	if err != nil {
 		log.Error("%v", err)
@@ -329,9 +581,8 @@ func UploadAction(server *LycheeServer, c *gin.Context) {
 		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
 		return
 	}
-	_, isValid := validateExtension(file.Filename)
-	if !isValid {
-		c.JSON(http.StatusBadRequest, fmt.Sprintf("Not a valid image file extension"))
+	if !SupportedFile(file.Filename) {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("Not a valid image or video file extension"))
 		return
 	}
 	log.Debug("Uploading file %s", file.Filename)
@@ -342,10 +593,12 @@ func UploadAction(server *LycheeServer, c *gin.Context) {
 		c.JSON(http.StatusBadRequest, fmt.Sprintf("upload file err: %s", err.Error()))
 		return
 	}
+	defer os.Remove(tmpFilepath)
 	photo, err := NewPhoto(server, tmpFilepath, file.Filename, id)
 	if err != nil {
 		log.Error("%v", err)
 		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
 	}
 	photo.Album = albumId
 
@@ -355,14 +608,13 @@ func UploadAction(server *LycheeServer, c *gin.Context) {
 		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
 		return
 	}
-	defer conn.Close()
-	err = photo.SavePhoto(conn, true)
+	err = photo.SavePhoto(conn, true, false)
 	if err != nil {
 		log.Error("%v", err)
 		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
 		return
 	}
-	c.JSON(http.StatusOK, id)
+	c.JSON(http.StatusOK, strconv.FormatInt(photo.ID, 10))
 }
 
 func (photo *Photo) GenPhotoExif() (err error) {
@@ -375,6 +627,10 @@ func (photo *Photo) GenPhotoExif() (err error) {
 	}
 	// get the size
 	photo.Size = humanize.Bytes(uint64(fi.Size()))
+	if photo.video != nil {
+		photo.videoMeta()
+		return nil
+	}
 	f, err := os.Open(photo.imagePath)
 	if err != nil {
 		log.Error("%v", err)
@@ -382,7 +638,12 @@ func (photo *Photo) GenPhotoExif() (err error) {
 	}
 	defer f.Close()
 
-	x, e := exif.Decode(f)
+	var x *exif.Exif
+	if photo.Type == imageTypes["heic"] {
+		x, e = heifExif(f)
+	} else {
+		x, e = exif.Decode(f)
+	}
 	if e != nil {
 		log.Error("%v", e)
 		return nil
@@ -455,9 +716,60 @@ func (photo *Photo) GenPhotoExif() (err error) {
 		log.Info("Takestamp " + photo.Takestamp)
 	}
 
+	lens, e := x.Get(exif.LensModel)
+	if e == nil {
+		photo.Lens, _ = lens.StringVal()
+	}
+
+	if bias, e := exifFloat(x, exif.ExposureBiasValue); e == nil {
+		photo.ExposureBias = fmt.Sprintf("%+.1f EV", bias)
+		if bias == 0 {
+			photo.ExposureBias = "0 EV"
+		}
+	}
+
+	photo.gpsExif(x)
+
 	return nil
 }
 
+// gpsExif sets the position the photo was taken at. Most photos have none,
+// so missing tags are not logged.
+func (photo *Photo) gpsExif(x *exif.Exif) {
+	lat, long, e := x.LatLong()
+	if e == nil {
+		photo.Latitude, photo.Longitude = &lat, &long
+	}
+	if alt, e := exifFloat(x, exif.GPSAltitude); e == nil {
+		// a reference of 1 is below sea level
+		if ref, e := x.Get(exif.GPSAltitudeRef); e == nil {
+			if v, e := ref.Int(0); e == nil && v == 1 {
+				alt = -alt
+			}
+		}
+		photo.Altitude = &alt
+	}
+	if dir, e := exifFloat(x, exif.GPSImgDirection); e == nil {
+		photo.ImgDirection = &dir
+	}
+}
+
+// exifFloat returns the value of a rational EXIF tag
+func exifFloat(x *exif.Exif, name exif.FieldName) (float64, error) {
+	tag, err := x.Get(name)
+	if err != nil {
+		return 0, err
+	}
+	numer, denom, err := tag.Rat2(0)
+	if err != nil {
+		return 0, err
+	}
+	if denom == 0 {
+		return 0, fmt.Errorf("%s: zero denominator", name)
+	}
+	return float64(numer) / float64(denom), nil
+}
+
 func (photo *Photo) CopyToUpload() (err error) {
 	from, err := os.Open(photo.imagePath)
 	if err != nil {
@@ -476,18 +788,41 @@ func (photo *Photo) CopyToUpload() (err error) {
 }
 
 func (photo *Photo) SavePhotoMeta(db *sql.DB) error {
-	_, err := db.Exec(`
-		 INSERT INTO lychee_photos (id, title, url, description, tags, type, width, height, size, iso, aperture, make, model, shutter, focal, takestamp, thumbUrl, album, public, star, checksum, medium) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		 `, photo.ID, photo.Title, photo.Url, photo.Description, photo.Tags, photo.Type, photo.Width, photo.Height,
-		photo.Size, photo.Iso, photo.Aperture, photo.Make, photo.Model, photo.Shutter, photo.Focal, photo.Takestamp, photo.ThumbUrl, photo.Album, photo.Public, photo.Star, photo.Checksum, photo.Medium)
+	// MySQL refuses '' for the integer column
+	var takestamp interface{}
+	if photo.Takestamp != "" {
+		takestamp = photo.Takestamp
+	}
+	id, err := insertWithID(db, "lychee_photos", photo.ID, func(id int64) error {
+		_, err := db.Exec(`
+		 INSERT INTO lychee_photos (id, title, url, description, tags, type, width, height, size, iso, aperture, make, model, shutter, focal, takestamp, thumbUrl, album, public, star, checksum, medium,
+		 latitude, longitude, altitude, imgDirection, lens, exposureBias) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 `, id, photo.Title, photo.Url, photo.Description, photo.Tags, photo.Type, photo.Width, photo.Height,
+			photo.Size, photo.Iso, photo.Aperture, photo.Make, photo.Model, photo.Shutter, photo.Focal, takestamp, photo.ThumbUrl, photo.Album, photo.Public, photo.Star, photo.Checksum, photo.Medium,
+			photo.Latitude, photo.Longitude, photo.Altitude, photo.ImgDirection, photo.Lens, photo.ExposureBias)
+		return err
+	})
 	if err != nil {
 		log.Error("%v", err)
 		return err
 	}
+	photo.ID = id
+	photo.idStr = strconv.FormatInt(id, 10)
 	return nil
 }
 
-func (photo *Photo) SavePhoto(db *sql.DB, copyToUpload bool) (err error) {
+// loadDuplicateFiles points the photo at the files of an existing photo with
+// the same checksum
+func (photo *Photo) loadDuplicateFiles(db *sql.DB) error {
+	return db.QueryRow("SELECT url, thumbUrl, medium FROM lychee_photos WHERE checksum = ? LIMIT 1", photo.Checksum).
+		Scan(&photo.Url, &photo.ThumbUrl, &photo.Medium)
+}
+
+// SavePhoto adds the photo to the library. A photo with the checksum of one
+// already in it shares its files, unless the skipDuplicates setting is on or
+// skipDuplicates is set, then it's refused. Importers set skipDuplicates so
+// they can be run again over the same files.
+func (photo *Photo) SavePhoto(db *sql.DB, copyToUpload bool, skipDuplicates bool) (err error) {
 	exists, err := photo.Exists(db)
 	if err != nil {
 		log.Error("%v", err)
@@ -495,7 +830,21 @@ func (photo *Photo) SavePhoto(db *sql.DB, copyToUpload bool) (err error) {
 	}
 
 	if exists {
-		return fmt.Errorf("Photo exists")
+		if skipDuplicates || photo.settings.SkipDuplicatesEnabled() {
+			return fmt.Errorf("Photo exists")
+		}
+		// share the files of the photo already in the library
+		err = photo.loadDuplicateFiles(db)
+		if err != nil {
+			log.Error("%v", err)
+			return
+		}
+		err = photo.GenPhotoExif()
+		if err != nil {
+			log.Error("%v", err)
+			return
+		}
+		return photo.SavePhotoMeta(db)
 	}
 
 	if copyToUpload {
@@ -547,7 +896,7 @@ func (photo *Photo) createThumb() error {
 		return err
 	}
 	defer out.Close()
-	err = jpeg.Encode(out, thumb, nil)
+	err = jpeg.Encode(out, thumb, &jpeg.Options{Quality: photo.settings.ThumbQualityValue()})
 	if err != nil {
 		log.Error("%v")
 		return err
@@ -558,7 +907,7 @@ func (photo *Photo) createThumb() error {
 		return err
 	}
 	defer out2x.Close()
-	err = jpeg.Encode(out2x, thumb2x, nil)
+	err = jpeg.Encode(out2x, thumb2x, &jpeg.Options{Quality: photo.settings.ThumbQualityValue()})
 	if err != nil {
 		log.Error("%v")
 		return err
@@ -568,22 +917,33 @@ func (photo *Photo) createThumb() error {
 	return err
 }
 
+// createMedium writes a smaller JPEG for large photos. Browsers can't show
+// RAW files, so these always get one, made from the preview. Videos are
+// played from the original and get none.
 func (photo *Photo) createMedium() {
+	raw := IsRaw(photo.Type)
+	if IsVideo(photo.Type) || (!photo.settings.MediumEnabled() && !raw) {
+		photo.Medium = ""
+		return
+	}
 	if helper.DoesFileExists(photo.mediumPath) {
 		log.Info("Medium file %s exists, continue", photo.mediumPath)
+		photo.Medium, _ = filepath.Rel(photo.dataPath, photo.mediumPath)
 		return
 	}
 	height := photo.img.Bounds().Size().Y
 	width := photo.img.Bounds().Size().X
-	if height <= 1920 && width <= 1920 {
+	m := photo.img
+	if height > 1920 || width > 1920 {
+		var newWidth int = 1920
+		if width < height {
+			newWidth = 1080
+		}
+		m = imaging.Resize(photo.img, newWidth, 0, imaging.Lanczos)
+	} else if !raw {
 		photo.Medium = ""
 		return
 	}
-	var newWidth int = 1920
-	if width < height {
-		newWidth = 1080
-	}
-	m := imaging.Resize(photo.img, newWidth, 0, imaging.Lanczos)
 	out, err := os.Create(photo.mediumPath)
 	if err != nil {
 		log.Error("%v", err)
@@ -591,7 +951,7 @@ func (photo *Photo) createMedium() {
 		return
 	}
 	defer out.Close()
-	err = jpeg.Encode(out, m, nil)
+	err = jpeg.Encode(out, m, &jpeg.Options{Quality: photo.settings.ThumbQualityValue()})
 	if err == nil {
 		photo.Medium, _ = filepath.Rel(photo.dataPath, photo.mediumPath)
 	} else {
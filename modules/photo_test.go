@@ -0,0 +1,80 @@
+package modules
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/litao91/lychee_go/util/helper"
+)
+
+// writePNG writes a small image to a file in dir
+func writePNG(t *testing.T, dir string) string {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	img.Set(1, 1, color.RGBA{255, 0, 0, 255})
+	file := filepath.Join(dir, "a.png")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err = png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestSavePhotoDuplicates(t *testing.T) {
+	tests := []struct {
+		name           string
+		setting        string
+		skipDuplicates bool
+		photos         int
+	}{
+		{"shared files", "0", false, 2},
+		{"setting on", "1", false, 1},
+		{"importer", "0", true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := NewServer(t.TempDir(), t.TempDir(), 0)
+			if err := server.Init(); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			defer server.Close()
+			if err := server.SetSetting("skipDuplicates", tt.setting); err != nil {
+				t.Fatal(err)
+			}
+			file := writePNG(t, t.TempDir())
+			conn, _ := server.GetDBConnection()
+
+			var errs []error
+			for i := 0; i < 2; i++ {
+				photo, err := NewPhoto(server, file, "a.png", strconv.FormatInt(helper.NextID(), 10))
+				if err != nil {
+					t.Fatalf("NewPhoto: %v", err)
+				}
+				errs = append(errs, photo.SavePhoto(conn, true, tt.skipDuplicates))
+			}
+			if errs[0] != nil {
+				t.Fatalf("first SavePhoto: %v", errs[0])
+			}
+			if (errs[1] == nil) != (tt.photos == 2) {
+				t.Errorf("second SavePhoto returned %v", errs[1])
+			}
+
+			var count, urls int
+			err := conn.QueryRow("SELECT COUNT(*), COUNT(DISTINCT url) FROM lychee_photos").Scan(&count, &urls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.photos || urls != 1 {
+				t.Errorf("%d photos with %d files, want %d photos sharing one file", count, urls, tt.photos)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package modules
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// RAW files are kept as uploaded. Thumbs, medium and dimensions come from
+// the largest JPEG preview the camera embedded in the TIFF structure of the
+// file, the raw sensor data is never decoded.
+
+// rawTypes maps the extensions of TIFF based RAW formats to their MIME type
+var rawTypes = map[string]string{
+	".cr2": "image/x-canon-cr2",
+	".nef": "image/x-nikon-nef",
+	".arw": "image/x-sony-arw",
+	".dng": "image/x-adobe-dng",
+}
+
+const (
+	tagCompression    = 0x0103
+	tagStripOffsets   = 0x0111
+	tagStripByteCount = 0x0117
+	tagSubIFDs        = 0x014a
+	tagJPEGOffset     = 0x0201
+	tagJPEGLength     = 0x0202
+
+	// maxIFDs guards against files whose IFDs point at each other
+	maxIFDs = 64
+)
+
+// IsRaw reports whether the photo type is a RAW format
+func IsRaw(photoType string) bool {
+	for _, t := range rawTypes {
+		if t == photoType {
+			return true
+		}
+	}
+	return false
+}
+
+// jpegSection is an embedded JPEG
+type jpegSection struct {
+	offset int64
+	length int64
+}
+
+// dirInt returns the first value of a tag of the IFD
+func dirInt(d *tiff.Dir, id uint16) (int64, bool) {
+	for _, t := range d.Tags {
+		if t.Id == id {
+			v, err := t.Int64(0)
+			return v, err == nil
+		}
+	}
+	return 0, false
+}
+
+// dirInts returns all values of a tag of the IFD
+func dirInts(d *tiff.Dir, id uint16) (vals []int64) {
+	for _, t := range d.Tags {
+		if t.Id != id {
+			continue
+		}
+		for i := 0; i < int(t.Count); i++ {
+			v, err := t.Int64(i)
+			if err != nil {
+				break
+			}
+			vals = append(vals, v)
+		}
+	}
+	return
+}
+
+// dirJPEGs returns the JPEGs an IFD points to. Previews are either given as
+// JPEGInterchangeFormat or as a single JPEG compressed strip.
+func dirJPEGs(d *tiff.Dir) (sections []jpegSection) {
+	if off, ok := dirInt(d, tagJPEGOffset); ok {
+		if n, ok := dirInt(d, tagJPEGLength); ok {
+			sections = append(sections, jpegSection{off, n})
+		}
+	}
+	if c, ok := dirInt(d, tagCompression); ok && (c == 6 || c == 7) {
+		offsets := dirInts(d, tagStripOffsets)
+		counts := dirInts(d, tagStripByteCount)
+		if len(offsets) == 1 && len(counts) == 1 {
+			sections = append(sections, jpegSection{offsets[0], counts[0]})
+		}
+	}
+	return
+}
+
+// rawJPEGs walks the IFD chain and the SubIFDs of a TIFF based RAW file
+// and collects the embedded JPEGs
+func rawJPEGs(f *os.File) (sections []jpegSection, err error) {
+	head := make([]byte, 8)
+	_, err = f.ReadAt(head, 0)
+	if err != nil {
+		return
+	}
+	var order binary.ByteOrder
+	switch string(head[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a TIFF based RAW file")
+	}
+	if order.Uint16(head[2:4]) != 42 {
+		return nil, fmt.Errorf("not a TIFF based RAW file")
+	}
+
+	queue := []int64{int64(order.Uint32(head[4:8]))}
+	seen := map[int64]bool{}
+	for len(queue) > 0 && len(seen) < maxIFDs {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset == 0 || seen[offset] {
+			continue
+		}
+		seen[offset] = true
+		_, err = f.Seek(offset, io.SeekStart)
+		if err != nil {
+			return
+		}
+		d, next, derr := tiff.DecodeDir(f, order)
+		if derr != nil {
+			// vendor IFDs are not always well formed, use what was found
+			continue
+		}
+		sections = append(sections, dirJPEGs(d)...)
+		queue = append(queue, dirInts(d, tagSubIFDs)...)
+		queue = append(queue, int64(uint32(next)))
+	}
+	return sections, nil
+}
+
+// rawPreview decodes the largest JPEG embedded in a RAW file
+func rawPreview(f *os.File) (image.Image, error) {
+	sections, err := rawJPEGs(f)
+	if err != nil {
+		return nil, err
+	}
+	var best *jpegSection
+	bestArea := 0
+	for i, s := range sections {
+		// lossless JPEG holds the sensor data of DNGs and fails here
+		cfg, err := jpeg.DecodeConfig(io.NewSectionReader(f, s.offset, s.length))
+		if err != nil {
+			continue
+		}
+		if area := cfg.Width * cfg.Height; area > bestArea {
+			best, bestArea = &sections[i], area
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no JPEG preview found in RAW file")
+	}
+	return jpeg.Decode(io.NewSectionReader(f, best.offset, best.length))
+}
@@ -1,12 +1,17 @@
 package modules
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
@@ -16,20 +21,6 @@ import (
 	"github.com/litao91/lychee_go/util/log"
 )
 
-type Settings struct {
-	ThumbQuality    string `json:"thumbQuality"`
-	CheckForUpdates string `json:"checkForUpdates"`
-	SortingPhotos   string `json:"sortingPhotos"`
-	DropboxKey      string `json:"dropboxKey"`
-	Version         string `json:"version"`
-	Imagick         string `json:"imagick"`
-	Medium          string `json:"medium"`
-	SortingAlbums   string `json:"sortingAlbums"`
-	SkipDuplicates  string `json:"skipDuplicates"`
-	Location        string `json:"location"`
-	Login           bool   `json:"login"`
-}
-
 type LycheeServer struct {
 	host     string
 	port     int64
@@ -37,13 +28,28 @@ type LycheeServer struct {
 	dataPath string
 	router   *gin.Engine
 	db       *LycheeDb
-	Settings *Settings
+
+	// Settings caches lychee_settings, use GetSettings to read it
+	Settings     *Settings
+	settingsLock sync.RWMutex
 
 	uploadsDir  string
 	mediumDir   string
 	thumbsDir   string
 	tmpDir      string
 	staticPaths []string
+
+	// SessionStore is "cookie" to keep sessions in signed cookies or "db"
+	// to keep them in the lychee_sessions table
+	SessionStore       string
+	SessionIdleTimeout time.Duration
+	SessionMaxAge      time.Duration
+	sessionStore       *DbStore
+
+	// Database is "sqlite" to keep the library in mainlib.db or "mysql" to
+	// keep it in the MySQL database DatabaseDSN points to
+	Database    string
+	DatabaseDSN string
 }
 
 type LycheeFunc func(*LycheeServer, *gin.Context)
@@ -56,12 +62,13 @@ func ActionToLycheeFunc(action ActionFunc, arg string) LycheeFunc {
 		if err != nil {
 			log.Error("%v", err)
 			c.JSON(500, fmt.Sprintf("%v", err))
+			return
 		}
-		defer conn.Close()
 		r, err := action(conn, c.PostForm(arg))
 		if err != nil {
 			log.Error("%v", err)
-			c.JSON(500, fmt.Sprintf("%v", err))
+			c.JSON(errorStatus(err), fmt.Sprintf("%v", err))
+			return
 		}
 		c.JSON(200, r)
 	}
@@ -73,34 +80,64 @@ func ActionToLycheeFuncTwoArg(action ActionFuncTwoArg, arg1 string, arg2 string)
 		if err != nil {
 			log.Error("%v", err)
 			c.JSON(500, fmt.Sprintf("%v", err))
+			return
 		}
-		defer conn.Close()
 		r, err := action(conn, c.PostForm(arg1), c.PostForm(arg2))
 		if err != nil {
 			log.Error("%v", err)
-			c.JSON(500, fmt.Sprintf("%v", err))
+			c.JSON(errorStatus(err), fmt.Sprintf("%v", err))
+			return
 		}
 		c.JSON(200, r)
 	}
 }
 
+// RequireLogin refuses to run f for sessions that are not logged in
+func RequireLogin(f LycheeFunc) LycheeFunc {
+	return func(server *LycheeServer, c *gin.Context) {
+		if !isLoggedIn(c) {
+			c.String(http.StatusUnauthorized, "Not logged in")
+			return
+		}
+		f(server, c)
+	}
+}
+
 var lycheeFuncMap map[string]LycheeFunc = map[string]LycheeFunc{
-	"Session::init":         InitAction,
-	"Session::login":        LoginAction,
-	"Albums::get":           GetAlbumsAction,
-	"Album::add":            AddAlbumAction,
-	"Album::get":            GetAlbumAction,
-	"Album::setTitle":       ActionToLycheeFuncTwoArg(SetAlbumTitle, "albumIDs", "title"),
-	"Album::setDescription": ActionToLycheeFuncTwoArg(SetAlbumDescription, "albumIDs", "description"),
-	"Album::delete":         ActionToLycheeFunc(DeleteAlbum, "albumIDs"),
-	"Photo::add":            UploadAction,
-	"Photo::get":            GetPhotoAction,
-	"Photo::setAlbum":       SetPhotoAlbumAction,
-	"Photo::setStar":        ActionToLycheeFunc(SetStar, "photoIDs"),
-	"Photo::setTitle":       ActionToLycheeFuncTwoArg(SetPhotoTitle, "photoIDs", "title"),
-	"Photo::setDescription": ActionToLycheeFuncTwoArg(SetPhotoDescription, "photoID", "description"),
-	"Photo::setTags":        ActionToLycheeFuncTwoArg(SetPhotoTags, "photoIDs", "tags"),
-	"Photo::delete":         DeletePhotoAction,
+	"Session::init":               InitAction,
+	"Session::login":              LoginAction,
+	"Session::logout":             LogoutAction,
+	"Albums::get":                 GetAlbumsAction,
+	"Album::add":                  RequireLogin(AddAlbumAction),
+	"Album::get":                  GetAlbumAction,
+	"Album::setTitle":             RequireLogin(ActionToLycheeFuncTwoArg(SetAlbumTitle, "albumIDs", "title")),
+	"Album::setDescription":       RequireLogin(ActionToLycheeFuncTwoArg(SetAlbumDescription, "albumIDs", "description")),
+	"Album::delete":               RequireLogin(DeleteAlbumAction),
+	"Album::restore":              RequireLogin(ActionToLycheeFunc(RestoreAlbums, "albumIDs")),
+	"Album::getPositionData":      GetPositionDataAction,
+	"Album::setPublic":            RequireLogin(SetAlbumPublicAction),
+	"Album::getPublic":            GetAlbumPublicAction,
+	"Album::getArchive":           GetAlbumArchiveAction,
+	"Albums::getPositionData":     GetPositionDataAction,
+	"Photo::add":                  RequireLogin(UploadAction),
+	"Photo::get":                  GetPhotoAction,
+	"Photo::setAlbum":             RequireLogin(SetPhotoAlbumAction),
+	"Photo::setStar":              RequireLogin(ActionToLycheeFunc(SetStar, "photoIDs")),
+	"Photo::setTitle":             RequireLogin(ActionToLycheeFuncTwoArg(SetPhotoTitle, "photoIDs", "title")),
+	"Photo::setDescription":       RequireLogin(ActionToLycheeFuncTwoArg(SetPhotoDescription, "photoID", "description")),
+	"Photo::setTags":              RequireLogin(ActionToLycheeFuncTwoArg(SetPhotoTags, "photoIDs", "tags")),
+	"Photo::delete":               RequireLogin(DeletePhotoAction),
+	"Photo::restore":              RequireLogin(ActionToLycheeFunc(RestorePhotos, "photoIDs")),
+	"Photo::setPublic":            RequireLogin(ActionToLycheeFunc(SetPhotoPublic, "photoID")),
+	"Photo::getArchive":           GetPhotoArchiveAction,
+	"Share::add":                  RequireLogin(AddShareAction),
+	"Share::list":                 RequireLogin(ListSharesAction),
+	"Share::delete":               RequireLogin(ActionToLycheeFunc(DeleteShare, "token")),
+	"Settings::setLogin":          RequireLogin(SetLoginAction),
+	"Settings::setSorting":        RequireLogin(SetSortingAction),
+	"Settings::setDropboxKey":     RequireLogin(SetDropboxKeyAction),
+	"Settings::setLang":           RequireLogin(SetLangAction),
+	"Settings::setTrashRetention": RequireLogin(SetTrashRetentionAction),
 }
 
 func (server *LycheeServer) GetDBConnection() (db *sql.DB, err error) {
@@ -122,11 +159,17 @@ func (server *LycheeServer) ServeFile(relativePath string) gin.HandlerFunc {
 	}
 }
 
-func (server *LycheeServer) ServeFunction(c *gin.Context) {
-	functionName := c.PostForm("function")
-	if functionName == "" {
-		functionName = c.Query("function")
+// formValue returns a form value, falling back to the query string for the
+// GET requests the frontend uses for downloads
+func formValue(c *gin.Context, key string) string {
+	if v := c.PostForm(key); v != "" {
+		return v
 	}
+	return c.Query(key)
+}
+
+func (server *LycheeServer) ServeFunction(c *gin.Context) {
+	functionName := formValue(c, "function")
 	log.Debug("Running for function: %s", functionName)
 	f, ok := lycheeFuncMap[functionName]
 	if !ok {
@@ -137,20 +180,55 @@ func (server *LycheeServer) ServeFunction(c *gin.Context) {
 }
 
 func (server *LycheeServer) initSessions() (err error) {
-	// init session
-	store := cookie.NewStore([]byte("lychee"))
+	secret, err := helper.LoadOrCreateKey(path.Join(server.dataPath, "session.key"), 32)
+	if err != nil {
+		log.Error("%v", err)
+		return
+	}
+	var store sessions.Store
+	switch server.SessionStore {
+	case "cookie":
+		store = cookie.NewStore(secret)
+	case "db":
+		var conn *sql.DB
+		conn, err = server.GetDBConnection()
+		if err != nil {
+			log.Error("%v", err)
+			return
+		}
+		server.sessionStore = NewDbStore(conn, server.SessionIdleTimeout, server.SessionMaxAge, secret)
+		go server.cleanupSessions()
+		store = server.sessionStore
+	default:
+		return fmt.Errorf("unknown session store %s", server.SessionStore)
+	}
+	store.Options(sessions.Options{
+		Path:     "/",
+		MaxAge:   int(server.SessionMaxAge.Seconds()),
+		HttpOnly: true,
+	})
 	server.router.Use(sessions.Sessions("lychee", store))
 	return nil
 }
 
+func (server *LycheeServer) cleanupSessions() {
+	for range time.Tick(time.Hour) {
+		err := server.sessionStore.Cleanup()
+		if err != nil {
+			log.Error("%v", err)
+		}
+	}
+}
+
 func (server *LycheeServer) initStaticDirectories() {
 	server.router.Use(static.Serve("/dist", static.LocalFile(path.Join(server.basePath, "dist"), false)))
 	server.router.Use(static.Serve("/src", static.LocalFile(path.Join(server.basePath, "src"), false)))
 	for _, i := range server.staticPaths {
 		s := strings.Split(i, "/")
-		p := "/" + s[len(s)-1]
+		p := "/" + s[len(s)-1] + "/*filepath"
 		log.Debug("Serving " + p)
-		server.router.Use(static.Serve(p, static.LocalFile(i, false)))
+		server.router.GET(p, server.serveDataFiles(i))
+		server.router.HEAD(p, server.serveDataFiles(i))
 	}
 }
 
@@ -168,20 +246,68 @@ func (server *LycheeServer) prepareDataDirs() {
 }
 
 func (server *LycheeServer) Init() (err error) {
-	server.db.InitDb()
-	server.initSessions()
+	server.db, err = NewDatabase(server.Database, server.DatabaseDSN, server.dataPath)
+	if err != nil {
+		return
+	}
+	err = server.db.InitDb()
+	if err != nil {
+		return
+	}
+	err = server.initSessions()
+	if err != nil {
+		return
+	}
 
 	// serve the index file for root
 	server.router.GET("/", server.ServeFile("index.html"))
 	server.router.POST("/php/index.php", server.ServeFunction)
 	server.router.GET("/php/index.php", server.ServeFunction)
+	server.router.GET("/s/:token", server.ServeShare)
 	server.prepareDataDirs()
 	server.initStaticDirectories()
 	return
 }
 
+// Run serves until interrupted, then shuts down gracefully and closes the
+// database. The trash is only purged while serving, not by tools that just
+// Init the server to work on the library.
 func (server *LycheeServer) Run() {
-	server.router.Run(fmt.Sprintf("%s:%d", server.host, server.port))
+	go server.purgeTrash()
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", server.host, server.port),
+		Handler: server.router,
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		log.Error("%v", err)
+	case sig := <-quit:
+		log.Info("Got %v, shutting down", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			log.Error("%v", err)
+		}
+	}
+	err := server.Close()
+	if err != nil {
+		log.Error("%v", err)
+	}
+}
+
+// Close releases the database
+func (server *LycheeServer) Close() error {
+	if server.db == nil {
+		return nil
+	}
+	return server.db.Close()
 }
 
 func NewServer(filePath string, dataPath string, port int64) (server *LycheeServer) {
@@ -191,7 +317,11 @@ func NewServer(filePath string, dataPath string, port int64) (server *LycheeServ
 		basePath: filePath,
 		router:   gin.Default(),
 		dataPath: dataPath,
-		db:       NewLycheeDb(path.Join(dataPath, "mainlib.db")),
+
+		SessionStore:       "cookie",
+		SessionIdleTimeout: 2 * time.Hour,
+		SessionMaxAge:      30 * 24 * time.Hour,
+		Database:           "sqlite",
 	}
 	return
 }
@@ -0,0 +1,194 @@
+package modules
+
+import (
+	"database/sql"
+	"encoding/base32"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gorilla/securecookie"
+	gsessions "github.com/gorilla/sessions"
+	"github.com/litao91/lychee_go/util/log"
+)
+
+// touchInterval limits how often a session's last access time is written back
+const touchInterval = time.Minute
+
+// DbStore keeps session data in the lychee_sessions table, the cookie
+// only carries the signed session ID. Sessions expire after IdleTimeout
+// without a request or MaxLifetime after creation, whichever comes first; a
+// zero duration disables that check. Deleting rows revokes sessions.
+type DbStore struct {
+	Codecs      []securecookie.Codec
+	IdleTimeout time.Duration
+	MaxLifetime time.Duration
+
+	db      *sql.DB
+	options *gsessions.Options
+}
+
+func NewDbStore(db *sql.DB, idleTimeout time.Duration, maxLifetime time.Duration, keyPairs ...[]byte) *DbStore {
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	for _, codec := range codecs {
+		if sc, ok := codec.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(int(maxLifetime.Seconds()))
+		}
+	}
+	return &DbStore{
+		Codecs:      codecs,
+		IdleTimeout: idleTimeout,
+		MaxLifetime: maxLifetime,
+		db:          db,
+		options: &gsessions.Options{
+			Path:   "/",
+			MaxAge: int(maxLifetime.Seconds()),
+		},
+	}
+}
+
+func (s *DbStore) Options(options sessions.Options) {
+	s.options = &gsessions.Options{
+		Path:     options.Path,
+		Domain:   options.Domain,
+		MaxAge:   options.MaxAge,
+		Secure:   options.Secure,
+		HttpOnly: options.HttpOnly,
+	}
+}
+
+func (s *DbStore) Get(r *http.Request, name string) (*gsessions.Session, error) {
+	return gsessions.GetRegistry(r).Get(s, name)
+}
+
+func (s *DbStore) New(r *http.Request, name string) (*gsessions.Session, error) {
+	session := gsessions.NewSession(s, name)
+	opts := *s.options
+	session.Options = &opts
+	session.IsNew = true
+	c, errCookie := r.Cookie(name)
+	if errCookie != nil {
+		return session, nil
+	}
+	err := securecookie.DecodeMulti(name, c.Value, &session.ID, s.Codecs...)
+	if err != nil {
+		session.ID = ""
+		return session, err
+	}
+	found, err := s.load(session)
+	if err != nil || !found {
+		// never reuse an ID the server doesn't know about
+		session.ID = ""
+		return session, err
+	}
+	session.IsNew = false
+	return session, nil
+}
+
+func (s *DbStore) Save(r *http.Request, w http.ResponseWriter, session *gsessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		err := s.Revoke(session.ID)
+		if err != nil {
+			return err
+		}
+		http.SetCookie(w, gsessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		session.ID = strings.TrimRight(base32.StdEncoding.EncodeToString(securecookie.GenerateRandomKey(32)), "=")
+	}
+	data, err := securecookie.EncodeMulti(session.Name(), session.Values, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	res, err := s.db.Exec("UPDATE lychee_sessions SET data = ?, updated = ? WHERE id = ?", data, now, session.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		_, err = s.db.Exec("INSERT INTO lychee_sessions (id, data, created, updated) VALUES (?, ?, ?, ?)", session.ID, data, now, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.Codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, gsessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// load fills the session values from the table, dropping the row if the
+// session has expired
+func (s *DbStore) load(session *gsessions.Session) (found bool, err error) {
+	var data string
+	var created, updated int64
+	err = s.db.QueryRow("SELECT data, created, updated FROM lychee_sessions WHERE id = ?", session.ID).Scan(&data, &created, &updated)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	if s.expired(now, created, updated) {
+		log.Debug("Session expired, removing it")
+		return false, s.Revoke(session.ID)
+	}
+	err = securecookie.DecodeMulti(session.Name(), data, &session.Values, s.Codecs...)
+	if err != nil {
+		return
+	}
+	if now.Sub(time.Unix(updated, 0)) > touchInterval {
+		_, err = s.db.Exec("UPDATE lychee_sessions SET updated = ? WHERE id = ?", now.Unix(), session.ID)
+	}
+	return true, err
+}
+
+func (s *DbStore) expired(now time.Time, created int64, updated int64) bool {
+	if s.IdleTimeout > 0 && now.Sub(time.Unix(updated, 0)) > s.IdleTimeout {
+		return true
+	}
+	if s.MaxLifetime > 0 && now.Sub(time.Unix(created, 0)) > s.MaxLifetime {
+		return true
+	}
+	return false
+}
+
+// Revoke removes a single session
+func (s *DbStore) Revoke(id string) error {
+	if id == "" {
+		return nil
+	}
+	_, err := s.db.Exec("DELETE FROM lychee_sessions WHERE id = ?", id)
+	return err
+}
+
+// RevokeAll logs out every session
+func (s *DbStore) RevokeAll() error {
+	_, err := s.db.Exec("DELETE FROM lychee_sessions")
+	return err
+}
+
+// Cleanup removes expired sessions from the table
+func (s *DbStore) Cleanup() error {
+	now := time.Now()
+	if s.IdleTimeout > 0 {
+		_, err := s.db.Exec("DELETE FROM lychee_sessions WHERE updated < ?", now.Add(-s.IdleTimeout).Unix())
+		if err != nil {
+			return err
+		}
+	}
+	if s.MaxLifetime > 0 {
+		_, err := s.db.Exec("DELETE FROM lychee_sessions WHERE created < ?", now.Add(-s.MaxLifetime).Unix())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,40 +3,128 @@ package modules
 import (
 	"net/http"
 
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
+	gsessions "github.com/gorilla/sessions"
+	"github.com/litao91/lychee_go/util/helper"
 	"github.com/litao91/lychee_go/util/log"
 )
 
-func getSettings(server *LycheeServer) (settings *Settings, err error) {
-	settings = &Settings{
-		ThumbQuality:    "90",
-		CheckForUpdates: "1",
-		SortingPhotos:   "id DESC",
-		DropboxKey:      "",
-		Version:         "030100",
-		Imagick:         "1",
-		Medium:          "1",
-		SortingAlbums:   "ORDER BY id DESC",
-		SkipDuplicates:  "0",
-		Location:        "",
-		Login:           true,
-	}
-	return
+// Status codes returned by Session::init, as expected by the frontend
+const (
+	StatusNoConfig  = 0
+	StatusLoggedOut = 1
+	StatusLoggedIn  = 2
+)
+
+func isLoggedIn(c *gin.Context) bool {
+	login, ok := sessions.Default(c).Get("login").(bool)
+	return ok && login
+}
+
+// setLoggedIn logs the session in. It's replaced by a new session first, so
+// an ID handed out before the login never becomes an authenticated session.
+func (server *LycheeServer) setLoggedIn(c *gin.Context) error {
+	err := server.renewSession(c)
+	if err != nil {
+		return err
+	}
+	session := sessions.Default(c)
+	session.Set("login", true)
+	return session.Save()
+}
+
+// renewSession drops the values of the session and makes the next Save
+// issue a new ID, revoking the old one in the database store. Cookie
+// sessions have no ID, their content changes with every Save anyway.
+func (server *LycheeServer) renewSession(c *gin.Context) error {
+	session := sessions.Default(c)
+	session.Clear()
+	s, ok := session.(interface{ Session() *gsessions.Session })
+	if !ok {
+		return nil
+	}
+	gs := s.Session()
+	if server.sessionStore != nil {
+		err := server.sessionStore.Revoke(gs.ID)
+		if err != nil {
+			return err
+		}
+	}
+	gs.ID = ""
+	gs.IsNew = true
+	return nil
 }
 
-// InitAction hardcode for now
+// InitAction returns the config and the login status of the session. When no
+// credentials are configured yet the session is logged in automatically and
+// config.login is false, so the frontend asks for new credentials.
 func InitAction(server *LycheeServer, c *gin.Context) {
 	log.Debug("Running Init Action")
-	settings, err := getSettings(server)
+	settings, err := server.GetSettings()
 	if err != nil {
 		log.Error("%v", err)
-		c.String(http.StatusBadRequest, "Getting config error")
+		c.JSON(200, gin.H{"status": StatusNoConfig})
 		return
 	}
-	server.Settings = settings
 
-	c.JSON(200, gin.H{"config": settings, "status": 2})
+	if !settings.Login && !isLoggedIn(c) {
+		err = server.setLoggedIn(c)
+		if err != nil {
+			log.Error("%v", err)
+		}
+	}
+
+	if !isLoggedIn(c) {
+		c.JSON(200, gin.H{
+			"config": gin.H{
+				"sortingPhotos": settings.SortingPhotos,
+				"sortingAlbums": settings.SortingAlbums,
+				"login":         settings.Login,
+				"lang":          settings.Lang,
+			},
+			"status": StatusLoggedOut,
+		})
+		return
+	}
+	c.JSON(200, gin.H{"config": settings, "status": StatusLoggedIn})
 }
 
+// LoginAction checks user and password against the hashes in lychee_settings
 func LoginAction(server *LycheeServer, c *gin.Context) {
+	user := c.PostForm("user")
+	password := c.PostForm("password")
+	settings, err := server.GetSettings()
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, "Getting config error")
+		return
+	}
+
+	if settings.Login && !(helper.CheckPassword(settings.Username, user) && helper.CheckPassword(settings.Password, password)) {
+		log.Warn("Failed login attempt from %s", c.ClientIP())
+		c.JSON(200, false)
+		return
+	}
+	err = server.setLoggedIn(c)
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	c.JSON(200, true)
+}
+
+// LogoutAction drops the session, removing it from the store
+func LogoutAction(server *LycheeServer, c *gin.Context) {
+	session := sessions.Default(c)
+	session.Clear()
+	session.Options(sessions.Options{Path: "/", MaxAge: -1})
+	err := session.Save()
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	c.JSON(200, true)
 }
@@ -0,0 +1,94 @@
+package modules
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/litao91/lychee_go/util/helper"
+)
+
+// request sends the request with the session cookie, if any, and returns the
+// response and the session cookie after it
+func request(server *LycheeServer, req *http.Request, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	server.router.ServeHTTP(w, req)
+	for _, c := range (&http.Response{Header: w.Header()}).Cookies() {
+		if c.Name == "lychee" {
+			cookie = c
+		}
+	}
+	return w, cookie
+}
+
+func function(server *LycheeServer, name string, form url.Values, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	form.Set("function", name)
+	req := httptest.NewRequest("POST", "/php/index.php", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return request(server, req, cookie)
+}
+
+// sessionStatus returns the status Session::init reports for the cookie
+func sessionStatus(t *testing.T, server *LycheeServer, cookie *http.Cookie) int {
+	w, _ := function(server, "Session::init", url.Values{}, cookie)
+	var r struct {
+		Status int `json:"status"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &r); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+	return r.Status
+}
+
+func TestLoginRenewsSession(t *testing.T) {
+	for _, store := range []string{"cookie", "db"} {
+		t.Run(store, func(t *testing.T) {
+			server := NewServer(t.TempDir(), t.TempDir(), 0)
+			server.SessionStore = store
+			if err := server.Init(); err != nil {
+				t.Fatalf("Init: %v", err)
+			}
+			defer server.Close()
+			for key, value := range map[string]string{"username": "admin", "password": "secret"} {
+				hash, err := helper.HashPassword(value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err = server.SetSetting(key, hash); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// opening a share link gives the guest a session
+			conn, _ := server.GetDBConnection()
+			_, err := conn.Exec("INSERT INTO lychee_shares (token, photo, album, created) VALUES ('token', 0, 1, 0)")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, guest := request(server, httptest.NewRequest("GET", "/s/token", nil), nil)
+			if guest == nil {
+				t.Fatalf("no session cookie for the guest")
+			}
+
+			w, user := function(server, "Session::login", url.Values{"user": {"admin"}, "password": {"secret"}}, guest)
+			if w.Body.String() != "true" {
+				t.Fatalf("login failed: %s", w.Body)
+			}
+			if user == guest || user.Value == guest.Value {
+				t.Fatalf("the session cookie didn't change on login")
+			}
+			if status := sessionStatus(t, server, user); status != StatusLoggedIn {
+				t.Errorf("status after login = %d, want %d", status, StatusLoggedIn)
+			}
+			if status := sessionStatus(t, server, guest); status != StatusLoggedOut {
+				t.Errorf("status of the cookie from before the login = %d, want %d", status, StatusLoggedOut)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package modules
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/litao91/lychee_go/util/helper"
+	"github.com/litao91/lychee_go/util/log"
+)
+
+// LycheeVersion is the version of the PHP API this server implements
+const LycheeVersion = "030100"
+
+// defaultSettings fills in keys that are missing from lychee_settings
+var defaultSettings = map[string]string{
+	"username":        "",
+	"password":        "",
+	"identifier":      "",
+	"checkForUpdates": "1",
+	"sortingPhotos":   "ORDER BY id DESC",
+	"sortingAlbums":   "ORDER BY id DESC",
+	"imagick":         "1",
+	"dropboxKey":      "",
+	"skipDuplicates":  "0",
+	"thumbQuality":    "90",
+	"medium":          "1",
+	"plugins":         "",
+	"lang":            "en",
+	"trashRetention":  "30",
+}
+
+var langPattern = regexp.MustCompile(`^[a-zA-Z_-]{2,10}$`)
+
+type Settings struct {
+	ThumbQuality    string `json:"thumbQuality"`
+	CheckForUpdates string `json:"checkForUpdates"`
+	SortingPhotos   string `json:"sortingPhotos"`
+	DropboxKey      string `json:"dropboxKey"`
+	Version         string `json:"version"`
+	Imagick         string `json:"imagick"`
+	Medium          string `json:"medium"`
+	SortingAlbums   string `json:"sortingAlbums"`
+	SkipDuplicates  string `json:"skipDuplicates"`
+	Location        string `json:"location"`
+	Login           bool   `json:"login"`
+	Lang            string `json:"lang"`
+	TrashRetention  string `json:"trashRetention"`
+
+	Username   string `json:"-"`
+	Password   string `json:"-"`
+	Identifier string `json:"-"`
+	Plugins    string `json:"-"`
+
+	photoSorting Sorting
+	albumSorting Sorting
+}
+
+// ThumbQualityValue returns the JPEG quality for generated thumbs and mediums
+func (settings *Settings) ThumbQualityValue() int {
+	q, err := strconv.Atoi(settings.ThumbQuality)
+	if err != nil || q < 1 || q > 100 {
+		return 90
+	}
+	return q
+}
+
+// TrashRetentionDuration returns how long deleted photos and albums are
+// kept in the trash, 0 keeps them forever
+func (settings *Settings) TrashRetentionDuration() time.Duration {
+	days, err := strconv.Atoi(settings.TrashRetention)
+	if err != nil || days < 0 {
+		return 30 * 24 * time.Hour
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func (settings *Settings) MediumEnabled() bool {
+	return settings.Medium == "1"
+}
+
+func (settings *Settings) SkipDuplicatesEnabled() bool {
+	return settings.SkipDuplicates == "1"
+}
+
+// PhotoSorting returns the configured photo order with its tie breakers
+func (settings *Settings) PhotoSorting() Sorting {
+	return settings.photoSorting.Then(photoTieBreakers...)
+}
+
+// AlbumSorting returns the configured album order with its tie breakers
+func (settings *Settings) AlbumSorting() Sorting {
+	return settings.albumSorting.Then(albumTieBreakers...)
+}
+
+func loadSettings(conn *sql.DB) (settings *Settings, err error) {
+	values := make(map[string]string, len(defaultSettings))
+	for k, v := range defaultSettings {
+		values[k] = v
+	}
+	rows, err := conn.Query("SELECT `key`, value FROM lychee_settings")
+	if err != nil {
+		log.Error("%v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		var value sql.NullString
+		err = rows.Scan(&key, &value)
+		if err != nil {
+			log.Error("%v", err)
+			return
+		}
+		values[key] = value.String
+	}
+	err = rows.Err()
+	if err != nil {
+		return
+	}
+
+	photoSorting := ParseSorting(values["sortingPhotos"], photoSortColumns, defaultPhotoSorting)
+	albumSorting := ParseSorting(values["sortingAlbums"], albumSortColumns, defaultAlbumSorting)
+	settings = &Settings{
+		ThumbQuality:    values["thumbQuality"],
+		CheckForUpdates: values["checkForUpdates"],
+		SortingPhotos:   photoSorting.String(),
+		DropboxKey:      values["dropboxKey"],
+		Version:         LycheeVersion,
+		Imagick:         values["imagick"],
+		Medium:          values["medium"],
+		SortingAlbums:   albumSorting.String(),
+		SkipDuplicates:  values["skipDuplicates"],
+		Location:        "",
+		Login:           values["username"] != "" || values["password"] != "",
+		Lang:            values["lang"],
+		TrashRetention:  values["trashRetention"],
+		Username:        values["username"],
+		Password:        values["password"],
+		Identifier:      values["identifier"],
+		Plugins:         values["plugins"],
+
+		photoSorting: photoSorting,
+		albumSorting: albumSorting,
+	}
+	return
+}
+
+// GetSettings returns the cached settings, loading them from the database
+// on first use or after they have been invalidated
+func (server *LycheeServer) GetSettings() (settings *Settings, err error) {
+	server.settingsLock.RLock()
+	settings = server.Settings
+	server.settingsLock.RUnlock()
+	if settings != nil {
+		return
+	}
+
+	server.settingsLock.Lock()
+	defer server.settingsLock.Unlock()
+	if server.Settings != nil {
+		return server.Settings, nil
+	}
+	conn, err := server.GetDBConnection()
+	if err != nil {
+		log.Error("%v", err)
+		return
+	}
+	settings, err = loadSettings(conn)
+	if err != nil {
+		return
+	}
+	server.Settings = settings
+	return
+}
+
+// SetSetting persists a single setting and invalidates the cache
+func (server *LycheeServer) SetSetting(key string, value string) (err error) {
+	conn, err := server.GetDBConnection()
+	if err != nil {
+		log.Error("%v", err)
+		return
+	}
+	res, err := conn.Exec("UPDATE lychee_settings SET value = ? WHERE `key` = ?", value, key)
+	if err != nil {
+		log.Error("%v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		_, err = conn.Exec("INSERT INTO lychee_settings (`key`, value) VALUES (?, ?)", key, value)
+		if err != nil {
+			log.Error("%v", err)
+			return
+		}
+	}
+	server.InvalidateSettings()
+	return
+}
+
+// InvalidateSettings drops the cached settings so the next GetSettings
+// reloads them
+func (server *LycheeServer) InvalidateSettings() {
+	server.settingsLock.Lock()
+	server.Settings = nil
+	server.settingsLock.Unlock()
+}
+
+// SetLoginAction sets new credentials. The first call creates the initial
+// login, later ones have to provide the current password.
+func SetLoginAction(server *LycheeServer, c *gin.Context) {
+	oldPassword := c.PostForm("oldPassword")
+	username := c.PostForm("username")
+	password := c.PostForm("password")
+	if username == "" || password == "" {
+		c.String(http.StatusBadRequest, "username and password can't be empty")
+		return
+	}
+	settings, err := server.GetSettings()
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, "Getting config error")
+		return
+	}
+	if settings.Login && !helper.CheckPassword(settings.Password, oldPassword) {
+		log.Warn("Wrong old password when changing login from %s", c.ClientIP())
+		c.JSON(200, false)
+		return
+	}
+
+	usernameHash, err := helper.HashPassword(username)
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	passwordHash, err := helper.HashPassword(password)
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	err = server.SetSetting("username", usernameHash)
+	if err == nil {
+		err = server.SetSetting("password", passwordHash)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+
+	// log out every other session still using the old credentials
+	if server.sessionStore != nil {
+		err = server.sessionStore.RevokeAll()
+		if err != nil {
+			log.Error("%v", err)
+		}
+	}
+	err = server.setLoggedIn(c)
+	if err != nil {
+		log.Error("%v", err)
+	}
+	c.JSON(200, true)
+}
+
+func SetSortingAction(server *LycheeServer, c *gin.Context) {
+	typeAlbums := c.PostForm("typeAlbums")
+	orderAlbums := c.PostForm("orderAlbums")
+	typePhotos := c.PostForm("typePhotos")
+	orderPhotos := c.PostForm("orderPhotos")
+	albumSorting, err := NewSorting(albumSortColumns, typeAlbums, orderAlbums)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	photoSorting, err := NewSorting(photoSortColumns, typePhotos, orderPhotos)
+	if err != nil {
+		c.String(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	err = server.SetSetting("sortingAlbums", albumSorting.String())
+	if err == nil {
+		err = server.SetSetting("sortingPhotos", photoSorting.String())
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	c.JSON(200, true)
+}
+
+func SetDropboxKeyAction(server *LycheeServer, c *gin.Context) {
+	err := server.SetSetting("dropboxKey", strings.TrimSpace(c.PostForm("key")))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	c.JSON(200, true)
+}
+
+func SetLangAction(server *LycheeServer, c *gin.Context) {
+	lang := c.PostForm("lang")
+	if !langPattern.MatchString(lang) {
+		c.String(http.StatusBadRequest, "Invalid language")
+		return
+	}
+	err := server.SetSetting("lang", lang)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	c.JSON(200, true)
+}
+
+// SetTrashRetentionAction sets the number of days deleted photos and albums
+// are kept in the trash, 0 keeps them forever
+func SetTrashRetentionAction(server *LycheeServer, c *gin.Context) {
+	days, err := strconv.Atoi(c.PostForm("days"))
+	if err != nil || days < 0 {
+		c.String(http.StatusBadRequest, "Invalid number of days")
+		return
+	}
+	err = server.SetSetting("trashRetention", strconv.Itoa(days))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, false)
+		return
+	}
+	c.JSON(200, true)
+}
@@ -0,0 +1,294 @@
+package modules
+
+import (
+	"database/sql"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/litao91/lychee_go/util/helper"
+	"github.com/litao91/lychee_go/util/log"
+)
+
+// Share links give anyone with the link access to a single photo or album,
+// public or not, without exposing anything else. Opening a link adds its
+// token to the session, access ends when the link expires or is deleted.
+
+// shareTokenLength is the number of random bytes of a share token
+const shareTokenLength = 24
+
+// Share is a share link of a photo or an album
+type Share struct {
+	Token   string `json:"token"`
+	Photo   int64  `json:"photoID"`
+	Album   int64  `json:"albumID"`
+	Created int64  `json:"created"`
+	Expires int64  `json:"expires"`
+	Views   int64  `json:"views"`
+	Url     string `json:"url"`
+}
+
+// sharePage shows the photo of a share link, the frontend can only show
+// photos within their album
+var sharePage = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{if .Title}}{{.Title}}{{else}}Lychee{{end}}</title>
+<style>
+body { margin: 0; background: #1d1d1d; color: #ccc; font-family: sans-serif; text-align: center; }
+img, video { display: block; margin: 0 auto; max-width: 100%; max-height: 90vh; }
+h1 { font-size: 1.2em; font-weight: normal; }
+</style>
+</head>
+<body>
+{{if .Video}}<video src="/{{.Url}}" controls></video>{{else}}<img src="/{{.Src}}" alt="{{.Title}}">{{end}}
+{{if .Title}}<h1>{{.Title}}</h1>{{end}}
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+</body>
+</html>
+`))
+
+// SetPhotoPublic toggles whether photos are public
+func SetPhotoPublic(db *sql.DB, photoIDs string) (interface{}, error) {
+	ids, err := ParseIDList(photoIDs)
+	if err != nil {
+		return false, err
+	}
+	in, args := inClause(ids)
+	_, err = db.Exec("UPDATE lychee_photos SET public = 1 - public WHERE id IN ("+in+")", args...)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// formID reads an optional ID, 0 if the form value is empty
+func formID(c *gin.Context, key string) (int64, error) {
+	v := c.PostForm(key)
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, badRequest("invalid %s %q", key, v)
+	}
+	return id, nil
+}
+
+// AddShareAction creates a share link for the photo photoID or the album
+// albumID. expires is the number of seconds the link is valid, it never
+// expires if not given.
+func AddShareAction(server *LycheeServer, c *gin.Context) {
+	photoID, err := formID(c, "photoID")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	albumID, err := formID(c, "albumID")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	if (photoID == 0) == (albumID == 0) {
+		c.JSON(http.StatusBadRequest, "either photoID or albumID is needed")
+		return
+	}
+	share := &Share{Photo: photoID, Album: albumID, Created: time.Now().Unix()}
+	if e := c.PostForm("expires"); e != "" {
+		seconds, err := strconv.ParseInt(e, 10, 64)
+		if err != nil || seconds < 0 {
+			c.JSON(http.StatusBadRequest, fmt.Sprintf("invalid expires %q", e))
+			return
+		}
+		if seconds > 0 {
+			share.Expires = share.Created + seconds
+		}
+	}
+
+	conn, err := server.GetDBConnection()
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	query := "SELECT COUNT(*) FROM lychee_photos WHERE id = ? AND trashed = 0"
+	id := photoID
+	if albumID != 0 {
+		query = "SELECT COUNT(*) FROM lychee_albums WHERE id = ? AND trashed = 0"
+		id = albumID
+	}
+	var count int
+	err = conn.QueryRow(query, id).Scan(&count)
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	if count == 0 {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("Unknown photo or album %d", id))
+		return
+	}
+
+	share.Token, err = helper.RandomToken(shareTokenLength)
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	_, err = conn.Exec("INSERT INTO lychee_shares (token, photo, album, created, expires) VALUES (?, ?, ?, ?, ?)",
+		share.Token, share.Photo, share.Album, share.Created, share.Expires)
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	share.Url = "/s/" + share.Token
+	c.JSON(200, share)
+}
+
+// ListSharesAction lists the share links, newest first, optionally only
+// those of photoID or albumID
+func ListSharesAction(server *LycheeServer, c *gin.Context) {
+	photoID, err := formID(c, "photoID")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	albumID, err := formID(c, "albumID")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, fmt.Sprintf("%v", err))
+		return
+	}
+	query := "SELECT token, photo, album, created, expires, views FROM lychee_shares"
+	conds := []string{}
+	args := []interface{}{}
+	if photoID != 0 {
+		conds = append(conds, "photo = ?")
+		args = append(args, photoID)
+	}
+	if albumID != 0 {
+		conds = append(conds, "album = ?")
+		args = append(args, albumID)
+	}
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	conn, err := server.GetDBConnection()
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	rows, err := conn.Query(query+" ORDER BY created DESC", args...)
+	if err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	defer rows.Close()
+	shares := []*Share{}
+	for rows.Next() {
+		s := &Share{}
+		err = rows.Scan(&s.Token, &s.Photo, &s.Album, &s.Created, &s.Expires, &s.Views)
+		if err != nil {
+			log.Error("%v", err)
+			c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+		s.Url = "/s/" + s.Token
+		shares = append(shares, s)
+	}
+	if err = rows.Err(); err != nil {
+		log.Error("%v", err)
+		c.JSON(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+	c.JSON(200, shares)
+}
+
+// DeleteShare revokes a share link
+func DeleteShare(db *sql.DB, token string) (interface{}, error) {
+	if token == "" {
+		return false, badRequest("no token given")
+	}
+	_, err := db.Exec("DELETE FROM lychee_shares WHERE token = ?", token)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ServeShare opens a share link. Albums are shown by the frontend, photos
+// on a page of their own.
+func (server *LycheeServer) ServeShare(c *gin.Context) {
+	token := c.Param("token")
+	conn, err := server.GetDBConnection()
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, "Can't connect to DB")
+		return
+	}
+	var photoID, albumID int64
+	err = conn.QueryRow("SELECT photo, album FROM lychee_shares WHERE token = ? AND (expires = 0 OR expires > ?)",
+		token, time.Now().Unix()).Scan(&photoID, &albumID)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "This link doesn't exist or has expired")
+		return
+	}
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	var photo *Photo
+	if photoID != 0 {
+		photo, err = loadPhotoFromRow(conn.QueryRow(PhotoSelectStmt+" WHERE id = ? AND trashed = 0", photoID))
+		if err == sql.ErrNoRows {
+			c.String(http.StatusNotFound, "This photo has been deleted")
+			return
+		}
+		if err != nil {
+			log.Error("%v", err)
+			c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+			return
+		}
+	}
+
+	_, err = conn.Exec("UPDATE lychee_shares SET views = views + 1 WHERE token = ?", token)
+	if err != nil {
+		log.Error("%v", err)
+	}
+	err = addShareToken(conn, c, token)
+	if err != nil {
+		log.Error("%v", err)
+		c.String(http.StatusInternalServerError, fmt.Sprintf("%v", err))
+		return
+	}
+
+	if photo == nil {
+		c.Redirect(http.StatusFound, "/#"+strconv.FormatInt(albumID, 10))
+		return
+	}
+	src := photo.Url
+	if photo.Medium != "" {
+		src = photo.Medium
+	}
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	err = sharePage.Execute(c.Writer, gin.H{
+		"Title":       photo.Title,
+		"Description": photo.Description,
+		"Url":         photo.Url,
+		"Src":         src,
+		"Video":       IsVideo(photo.Type),
+	})
+	if err != nil {
+		log.Error("%v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package modules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/litao91/lychee_go/util/log"
+)
+
+// SortKey is a single column of an ORDER BY
+type SortKey struct {
+	Column string
+	Desc   bool
+}
+
+func (k SortKey) String() string {
+	if k.Desc {
+		return k.Column + " DESC"
+	}
+	return k.Column + " ASC"
+}
+
+// Sorting is an ORDER BY built only from whitelisted columns, so it is safe
+// to put into a query. The first key is the one configured by the user, the
+// rest are tie breakers.
+type Sorting struct {
+	keys []SortKey
+}
+
+// columns photos and albums may be sorted by, in the order they are used as
+// tie breakers
+var (
+	photoSortColumns = []string{"id", "takestamp", "title", "description", "public", "star", "type"}
+	albumSortColumns = []string{"id", "title", "description", "public"}
+
+	photoTieBreakers = []string{"takestamp", "id"}
+	albumTieBreakers = []string{"id"}
+
+	defaultPhotoSorting = Sorting{keys: []SortKey{{Column: "id", Desc: true}}}
+	defaultAlbumSorting = Sorting{keys: []SortKey{{Column: "id", Desc: true}}}
+)
+
+func isSortColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSorting validates column and order ("ASC" or "DESC") against columns
+func NewSorting(columns []string, column string, order string) (Sorting, error) {
+	if !isSortColumn(columns, column) {
+		return Sorting{}, fmt.Errorf("can't sort by %q", column)
+	}
+	order = strings.ToUpper(order)
+	if order != "ASC" && order != "DESC" {
+		return Sorting{}, fmt.Errorf("invalid sort order %q", order)
+	}
+	return Sorting{keys: []SortKey{{Column: column, Desc: order == "DESC"}}}, nil
+}
+
+// ParseSorting parses a sorting setting like "ORDER BY takestamp DESC",
+// returning fallback if it contains anything but whitelisted columns
+func ParseSorting(setting string, columns []string, fallback Sorting) Sorting {
+	s := strings.TrimSpace(setting)
+	if strings.HasPrefix(strings.ToUpper(s), "ORDER BY ") {
+		s = s[len("ORDER BY "):]
+	}
+	sorting := Sorting{}
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Fields(part)
+		order := "ASC"
+		switch len(fields) {
+		case 1:
+		case 2:
+			order = fields[1]
+		default:
+			log.Warn("Invalid sorting %q, using default", setting)
+			return fallback
+		}
+		k, err := NewSorting(columns, fields[0], order)
+		if err != nil {
+			log.Warn("Invalid sorting %q, using default: %v", setting, err)
+			return fallback
+		}
+		sorting.keys = append(sorting.keys, k.keys...)
+	}
+	return sorting
+}
+
+// Then appends the tie breaker columns that aren't sorted by yet, in the
+// direction of the first key
+func (s Sorting) Then(columns ...string) Sorting {
+	keys := make([]SortKey, len(s.keys), len(s.keys)+len(columns))
+	copy(keys, s.keys)
+	desc := len(keys) > 0 && keys[0].Desc
+	for _, c := range columns {
+		if !s.has(c) {
+			keys = append(keys, SortKey{Column: c, Desc: desc})
+		}
+	}
+	return Sorting{keys: keys}
+}
+
+// First puts key in front of the sorting, e.g. to list starred photos first
+func (s Sorting) First(key SortKey) Sorting {
+	keys := []SortKey{key}
+	for _, k := range s.keys {
+		if k.Column != key.Column {
+			keys = append(keys, k)
+		}
+	}
+	return Sorting{keys: keys}
+}
+
+func (s Sorting) has(column string) bool {
+	for _, k := range s.keys {
+		if k.Column == column {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderBy returns the ORDER BY clause, with a leading space
+func (s Sorting) OrderBy() string {
+	if len(s.keys) == 0 {
+		return ""
+	}
+	parts := make([]string, len(s.keys))
+	for i, k := range s.keys {
+		parts[i] = k.String()
+	}
+	return " ORDER BY " + strings.Join(parts, ", ")
+}
+
+// String returns the setting form of the user configured key, as the
+// frontend expects it
+func (s Sorting) String() string {
+	if len(s.keys) == 0 {
+		return ""
+	}
+	return "ORDER BY " + s.keys[0].String()
+}
@@ -0,0 +1,227 @@
+package modules
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/litao91/lychee_go/util/log"
+)
+
+// Photos and albums in the trash have trashed set to the unix time they were
+// deleted at, it is 0 for everything else. An album is trashed together with
+// its photos, sharing the timestamp, so restoring the album brings back
+// exactly those photos.
+
+// selectIDs runs a query selecting a single id column
+func selectIDs(db *sql.DB, query string, args ...interface{}) (ids []int64, err error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		err = rows.Scan(&id)
+		if err != nil {
+			return
+		}
+		ids = append(ids, id)
+	}
+	err = rows.Err()
+	return
+}
+
+// TrashPhotos moves photos to the trash, photos already in the trash are
+// deleted for good
+func TrashPhotos(server *LycheeServer, db *sql.DB, ids []int64) error {
+	in, args := inClause(ids)
+	trashed, err := selectIDs(db, "SELECT id FROM lychee_photos WHERE trashed > 0 AND id IN ("+in+")", args...)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("UPDATE lychee_photos SET trashed = ? WHERE trashed = 0 AND id IN ("+in+")",
+		append([]interface{}{time.Now().Unix()}, args...)...)
+	if err != nil {
+		return err
+	}
+	if len(trashed) == 0 {
+		return nil
+	}
+	return DeletePhotos(server, db, trashed)
+}
+
+// TrashAlbums moves albums and their photos to the trash, albums already in
+// the trash are deleted for good
+func TrashAlbums(server *LycheeServer, db *sql.DB, ids []int64) error {
+	in, args := inClause(ids)
+	trashed, err := selectIDs(db, "SELECT id FROM lychee_albums WHERE trashed > 0 AND id IN ("+in+")", args...)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	now := []interface{}{time.Now().Unix()}
+	_, err = tx.Exec("UPDATE lychee_photos SET trashed = ? WHERE trashed = 0 AND album IN ("+in+")", append(now, args...)...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("UPDATE lychee_albums SET trashed = ? WHERE trashed = 0 AND id IN ("+in+")", append(now, args...)...)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	if len(trashed) == 0 {
+		return nil
+	}
+	return deleteAlbums(server, db, trashed)
+}
+
+// deleteAlbums removes albums for good, along with their photos in the trash
+func deleteAlbums(server *LycheeServer, db *sql.DB, ids []int64) error {
+	in, args := inClause(ids)
+	photos, err := selectIDs(db, "SELECT id FROM lychee_photos WHERE trashed > 0 AND album IN ("+in+")", args...)
+	if err != nil {
+		return err
+	}
+	if len(photos) > 0 {
+		err = DeletePhotos(server, db, photos)
+		if err != nil {
+			return err
+		}
+	}
+	// photos restored on their own stay in the library
+	_, err = db.Exec("UPDATE lychee_photos SET album = 0 WHERE album IN ("+in+")", args...)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM lychee_shares WHERE album IN ("+in+")", args...)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM lychee_albums WHERE id IN ("+in+")", args...)
+	return err
+}
+
+// RestorePhotos takes photos out of the trash. Photos whose album is still in
+// the trash are restored to unsorted.
+func RestorePhotos(db *sql.DB, photoIDs string) (interface{}, error) {
+	ids, err := ParseIDList(photoIDs)
+	if err != nil {
+		return false, err
+	}
+	in, args := inClause(ids)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error("%v", err)
+		return false, err
+	}
+	_, err = tx.Exec("UPDATE lychee_photos SET album = 0 WHERE id IN ("+in+") AND album IN (SELECT id FROM lychee_albums WHERE trashed > 0)", args...)
+	if err != nil {
+		tx.Rollback()
+		log.Error("%v", err)
+		return false, err
+	}
+	_, err = tx.Exec("UPDATE lychee_photos SET trashed = 0 WHERE id IN ("+in+")", args...)
+	if err != nil {
+		tx.Rollback()
+		log.Error("%v", err)
+		return false, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Error("%v", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// RestoreAlbums takes albums out of the trash together with the photos that
+// were trashed with them
+func RestoreAlbums(db *sql.DB, albumIDs string) (interface{}, error) {
+	ids, err := ParseIDList(albumIDs)
+	if err != nil {
+		return false, err
+	}
+	in, args := inClause(ids)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Error("%v", err)
+		return false, err
+	}
+	_, err = tx.Exec(`UPDATE lychee_photos SET trashed = 0 WHERE album IN (`+in+`)
+		AND trashed = (SELECT trashed FROM lychee_albums WHERE lychee_albums.id = lychee_photos.album)`, args...)
+	if err != nil {
+		tx.Rollback()
+		log.Error("%v", err)
+		return false, err
+	}
+	_, err = tx.Exec("UPDATE lychee_albums SET trashed = 0 WHERE id IN ("+in+")", args...)
+	if err != nil {
+		tx.Rollback()
+		log.Error("%v", err)
+		return false, err
+	}
+	err = tx.Commit()
+	if err != nil {
+		log.Error("%v", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// PurgeTrash deletes everything that was trashed before the given time
+func PurgeTrash(server *LycheeServer, db *sql.DB, before time.Time) error {
+	albums, err := selectIDs(db, "SELECT id FROM lychee_albums WHERE trashed > 0 AND trashed < ?", before.Unix())
+	if err != nil {
+		return err
+	}
+	if len(albums) > 0 {
+		log.Info("Purging %d albums from the trash", len(albums))
+		err = deleteAlbums(server, db, albums)
+		if err != nil {
+			return err
+		}
+	}
+	photos, err := selectIDs(db, "SELECT id FROM lychee_photos WHERE trashed > 0 AND trashed < ?", before.Unix())
+	if err != nil {
+		return err
+	}
+	if len(photos) > 0 {
+		log.Info("Purging %d photos from the trash", len(photos))
+		err = DeletePhotos(server, db, photos)
+	}
+	return err
+}
+
+// purgeTrash runs PurgeTrash every hour with the configured retention
+func (server *LycheeServer) purgeTrash() {
+	for ; ; time.Sleep(time.Hour) {
+		settings, err := server.GetSettings()
+		if err != nil {
+			log.Error("%v", err)
+			continue
+		}
+		retention := settings.TrashRetentionDuration()
+		if retention <= 0 {
+			continue
+		}
+		conn, err := server.GetDBConnection()
+		if err != nil {
+			log.Error("%v", err)
+			continue
+		}
+		err = PurgeTrash(server, conn, time.Now().Add(-retention))
+		if err != nil {
+			log.Error("%v", err)
+		}
+	}
+}
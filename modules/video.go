@@ -0,0 +1,287 @@
+package modules
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// Videos are kept as uploaded. Dimensions, duration and creation time are
+// read from the MP4/QuickTime container, thumbs come from a poster frame
+// ffmpeg extracts, or from a placeholder if ffmpeg isn't installed.
+
+// videoTypes maps the extensions of videos to their MIME type
+var videoTypes = map[string]string{
+	".mp4":  "video/mp4",
+	".m4v":  "video/mp4",
+	".mov":  "video/quicktime",
+	".webm": "video/webm",
+}
+
+// mp4Epoch is the start of the time stamps in MP4 and QuickTime files
+var mp4Epoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// IsVideo reports whether the photo type is a video
+func IsVideo(photoType string) bool {
+	for _, t := range videoTypes {
+		if t == photoType {
+			return true
+		}
+	}
+	return false
+}
+
+// videoInfo is what the container tells about a video, zero if unknown
+type videoInfo struct {
+	width    int
+	height   int
+	duration time.Duration
+	created  time.Time
+}
+
+// box is an ISO base media file format box, data spans its payload
+type box struct {
+	kind   string
+	offset int64
+	size   int64
+}
+
+// readBoxes returns the boxes in the given range of the file
+func readBoxes(r io.ReaderAt, offset int64, end int64) (boxes []box, err error) {
+	head := make([]byte, 16)
+	for offset+8 <= end {
+		_, err = r.ReadAt(head[:8], offset)
+		if err != nil {
+			return
+		}
+		size := int64(binary.BigEndian.Uint32(head[:4]))
+		kind := string(head[4:8])
+		headLen := int64(8)
+		switch size {
+		case 0:
+			size = end - offset
+		case 1:
+			_, err = r.ReadAt(head[8:16], offset+8)
+			if err != nil {
+				return
+			}
+			size = int64(binary.BigEndian.Uint64(head[8:16]))
+			headLen = 16
+		}
+		if size < headLen || offset+size > end {
+			return boxes, fmt.Errorf("mp4: malformed %q box", kind)
+		}
+		boxes = append(boxes, box{kind, offset + headLen, size - headLen})
+		offset += size
+	}
+	return
+}
+
+func findBox(boxes []box, kind string) (box, bool) {
+	for _, b := range boxes {
+		if b.kind == kind {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+func readBox(r io.ReaderAt, b box, max int64) ([]byte, error) {
+	if b.size > max {
+		b.size = max
+	}
+	buf := make([]byte, b.size)
+	_, err := r.ReadAt(buf, b.offset)
+	return buf, err
+}
+
+// parseMP4 reads moov/mvhd for the duration and creation time and the track
+// header of the first video track for the dimensions
+func parseMP4(f *os.File) (info videoInfo, err error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return
+	}
+	top, err := readBoxes(f, 0, fi.Size())
+	if err != nil && len(top) == 0 {
+		return
+	}
+	moov, ok := findBox(top, "moov")
+	if !ok {
+		return info, fmt.Errorf("mp4: no moov box")
+	}
+	children, err := readBoxes(f, moov.offset, moov.offset+moov.size)
+	if err != nil {
+		return
+	}
+	for _, b := range children {
+		switch b.kind {
+		case "mvhd":
+			var d []byte
+			d, err = readBox(f, b, 32)
+			if err != nil {
+				return
+			}
+			parseMvhd(d, &info)
+		case "trak":
+			if info.width > 0 {
+				continue
+			}
+			var trak []box
+			trak, err = readBoxes(f, b.offset, b.offset+b.size)
+			if err != nil {
+				return
+			}
+			if tkhd, ok := findBox(trak, "tkhd"); ok {
+				var d []byte
+				d, err = readBox(f, tkhd, 96)
+				if err != nil {
+					return
+				}
+				parseTkhd(d, &info)
+			}
+		}
+	}
+	return info, nil
+}
+
+func parseMvhd(d []byte, info *videoInfo) {
+	var created, timescale, duration uint64
+	switch {
+	case len(d) >= 20 && d[0] == 0:
+		created = uint64(binary.BigEndian.Uint32(d[4:8]))
+		timescale = uint64(binary.BigEndian.Uint32(d[12:16]))
+		duration = uint64(binary.BigEndian.Uint32(d[16:20]))
+	case len(d) >= 32 && d[0] == 1:
+		created = binary.BigEndian.Uint64(d[4:12])
+		timescale = uint64(binary.BigEndian.Uint32(d[20:24]))
+		duration = binary.BigEndian.Uint64(d[24:32])
+	default:
+		return
+	}
+	if created > 0 {
+		info.created = mp4Epoch.Add(time.Duration(created) * time.Second)
+	}
+	if timescale > 0 {
+		info.duration = time.Duration(duration) * time.Second / time.Duration(timescale)
+	}
+}
+
+// parseTkhd reads the dimensions of a track, audio tracks have none. A
+// rotation of 90 or 270 degrees in the matrix swaps them, phones record
+// portrait videos that way.
+func parseTkhd(d []byte, info *videoInfo) {
+	// version and flags, times, track ID, reserved and duration
+	start := 4 + 20
+	if len(d) > 0 && d[0] == 1 {
+		start = 4 + 32
+	}
+	// reserved, layer, alternate group, volume, reserved
+	matrix := start + 16
+	dims := matrix + 36
+	if len(d) < dims+8 {
+		return
+	}
+	width := int(binary.BigEndian.Uint32(d[dims:dims+4]) >> 16)
+	height := int(binary.BigEndian.Uint32(d[dims+4:dims+8]) >> 16)
+	a := int32(binary.BigEndian.Uint32(d[matrix : matrix+4]))
+	if a == 0 {
+		width, height = height, width
+	}
+	info.width, info.height = width, height
+}
+
+// videoPoster returns a frame of the video, or a placeholder
+func videoPoster(videoPath string, info videoInfo) image.Image {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return videoPlaceholder(info)
+	}
+	out, err := ioutil.TempFile("", "lychee-poster-*.jpg")
+	if err != nil {
+		return videoPlaceholder(info)
+	}
+	out.Close()
+	defer os.Remove(out.Name())
+	// a second in skips the black frames many videos start with, very short
+	// videos fall back to the first frame
+	for _, at := range []string{"1", "0"} {
+		err = exec.Command(ffmpeg, "-y", "-loglevel", "error", "-ss", at, "-i", videoPath,
+			"-frames:v", "1", "-f", "image2", out.Name()).Run()
+		if err != nil {
+			continue
+		}
+		f, err := os.Open(out.Name())
+		if err != nil {
+			continue
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err == nil {
+			return img
+		}
+	}
+	return videoPlaceholder(info)
+}
+
+const (
+	// placeholderSize is the longer side of the placeholder in pixels
+	placeholderSize = 1280
+	// maxPlaceholderAspect bounds how wide, or tall, the placeholder gets.
+	// The size comes from the container and is not to be trusted.
+	maxPlaceholderAspect = 4
+)
+
+// videoPlaceholder draws a play symbol in the aspect ratio of the video
+func videoPlaceholder(info videoInfo) image.Image {
+	aspect := 16.0 / 9
+	if info.width > 0 && info.height > 0 {
+		aspect = math.Max(1.0/maxPlaceholderAspect, math.Min(maxPlaceholderAspect, float64(info.width)/float64(info.height)))
+	}
+	w, h := placeholderSize, placeholderSize
+	if aspect >= 1 {
+		h = int(placeholderSize / aspect)
+	} else {
+		w = int(placeholderSize * aspect)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{40, 40, 40, 255}}, image.Point{}, draw.Src)
+	fg := color.RGBA{220, 220, 220, 255}
+	size := h / 4
+	if w < h {
+		size = w / 4
+	}
+	// a triangle pointing right, centered
+	left, cy := w/2-size/2, h/2
+	for dx := 0; dx <= size; dx++ {
+		for dy := 0; dy <= (size-dx)/2; dy++ {
+			img.SetRGBA(left+dx, cy-dy, fg)
+			img.SetRGBA(left+dx, cy+dy, fg)
+		}
+	}
+	return img
+}
+
+// videoMeta sets what the container told about the video. Like the PHP
+// Lychee, which the frontend is written for, the duration goes in aperture.
+func (photo *Photo) videoMeta() {
+	info := photo.video
+	if info.width > 0 && info.height > 0 {
+		photo.Width, photo.Height = info.width, info.height
+	}
+	if !info.created.IsZero() {
+		photo.Takestamp = fmt.Sprintf("%v", info.created.Unix())
+	}
+	if info.duration > 0 {
+		s := int(info.duration.Seconds())
+		photo.Aperture = fmt.Sprintf("%d:%02d", s/60, s%60)
+	}
+}
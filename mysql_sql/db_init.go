@@ -0,0 +1,118 @@
+package mysql_sql
+
+// The statements are kept apart as the driver runs one statement per Exec.
+// key and function are quoted as MySQL reserves those words. Unlike SQLite,
+// MySQL enforces the column sizes, url and thumbUrl are wider than in PHP
+// Lychee to hold the paths below the data directory.
+
+var CreateAlbumsStmt string = `
+CREATE TABLE IF NOT EXISTS lychee_albums (
+  id bigint(14) NOT NULL,
+  title varchar(100) NOT NULL DEFAULT '',
+  description varchar(1000) DEFAULT '',
+  sysstamp int(11) NOT NULL,
+  public tinyint(1) NOT NULL DEFAULT '0',
+  visible tinyint(1) NOT NULL DEFAULT '1',
+  downloadable tinyint(1) NOT NULL DEFAULT '0',
+  password varchar(100) DEFAULT NULL,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+`
+
+var CreateLogStmt string = `
+CREATE TABLE IF NOT EXISTS lychee_log (
+  id int(11) NOT NULL AUTO_INCREMENT,
+  time int(11) NOT NULL,
+  type varchar(11) NOT NULL,
+  ` + "`function`" + ` varchar(100) NOT NULL,
+  line int(11) NOT NULL,
+  text text,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+`
+
+var CreatePhotosStmt string = `
+CREATE TABLE IF NOT EXISTS lychee_photos (
+  id bigint(14) NOT NULL,
+  title varchar(100) NOT NULL DEFAULT '',
+  description varchar(1000) DEFAULT '',
+  url varchar(255) NOT NULL,
+  tags varchar(1000) NOT NULL DEFAULT '',
+  public tinyint(1) NOT NULL,
+  type varchar(10) NOT NULL,
+  width int(11) NOT NULL,
+  height int(11) NOT NULL,
+  size varchar(20) NOT NULL,
+  iso varchar(15) NOT NULL,
+  aperture varchar(20) NOT NULL,
+  make varchar(50) NOT NULL,
+  model varchar(50) NOT NULL,
+  shutter varchar(30) NOT NULL,
+  focal varchar(20) NOT NULL,
+  takestamp int(11) DEFAULT NULL,
+  star tinyint(1) NOT NULL,
+  thumbUrl varchar(100) NOT NULL,
+  album bigint(20) NOT NULL,
+  checksum char(40) DEFAULT NULL,
+  medium varchar(100) NOT NULL DEFAULT '',
+  PRIMARY KEY (id),
+  KEY Index_album (album)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+`
+
+var CreateSettingsStmt string = `
+CREATE TABLE IF NOT EXISTS lychee_settings (
+  ` + "`key`" + ` varchar(50) NOT NULL DEFAULT '',
+  value varchar(200) DEFAULT ''
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+`
+
+var CreateSessionsStmt string = `
+CREATE TABLE IF NOT EXISTS lychee_sessions (
+  id varchar(64) NOT NULL,
+  data text NOT NULL,
+  created int(11) NOT NULL,
+  updated int(11) NOT NULL,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+`
+
+var CreateSharesStmt string = `
+CREATE TABLE IF NOT EXISTS lychee_shares (
+  token varchar(64) NOT NULL,
+  photo bigint(20) NOT NULL DEFAULT '0',
+  album bigint(20) NOT NULL DEFAULT '0',
+  created int(11) NOT NULL,
+  expires int(11) NOT NULL DEFAULT '0',
+  views int(11) NOT NULL DEFAULT '0',
+  PRIMARY KEY (token)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4
+`
+
+var DefaultSettingsStmt string = `
+INSERT IGNORE INTO lychee_settings (` + "`key`" + `, value)
+VALUES
+  ('version',''),
+  ('username',''),
+  ('password',''),
+  ('checkForUpdates','1'),
+  ('sortingPhotos','ORDER BY id DESC'),
+  ('sortingAlbums','ORDER BY id DESC'),
+  ('imagick','1'),
+  ('dropboxKey',''),
+  ('identifier',''),
+  ('skipDuplicates','0'),
+  ('plugins',''),
+  ('trashRetention','30')
+`
+
+// PhotoMimeTypesStmt replaces the image format stored by earlier versions
+// with the MIME type PHP Lychee uses
+var PhotoMimeTypesStmt string = `
+UPDATE lychee_photos SET type = 'image/jpeg' WHERE type = 'jpeg'
+`
+
+// WidePhotoTypeStmt makes room for the MIME types of RAW formats
+var WidePhotoTypeStmt string = `
+ALTER TABLE lychee_photos MODIFY type varchar(30) NOT NULL
+`
@@ -8,17 +8,19 @@ CREATE TABLE IF NOT EXISTS `lychee_albums` (
   `visible` tinyint(1) NOT NULL DEFAULT '1',
   `downloadable` tinyint(1) NOT NULL DEFAULT '0',
   `password` varchar(100) DEFAULT NULL,
+  `trashed` int(11) NOT NULL DEFAULT '0',
   PRIMARY KEY (`id`)
 );
 
 
 CREATE TABLE IF NOT EXISTS `lychee_log` (
-  `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+  `id` int(11) NOT NULL AUTO_INCREMENT,
   `time` int(11) NOT NULL,
   `type` varchar(11) NOT NULL,
   `function` varchar(100) NOT NULL,
   `line` int(11) NOT NULL,
-  `text` text
+  `text` text,
+  PRIMARY KEY (`id`)
 );
 
 
@@ -26,10 +28,10 @@ CREATE TABLE IF NOT EXISTS `lychee_photos` (
   `id` bigint(14) NOT NULL,
   `title` varchar(100) NOT NULL DEFAULT '',
   `description` varchar(1000) DEFAULT '',
-  `url` varchar(100) NOT NULL,
+  `url` varchar(255) NOT NULL,
   `tags` varchar(1000) NOT NULL DEFAULT '',
   `public` tinyint(1) NOT NULL,
-  `type` varchar(10) NOT NULL,
+  `type` varchar(30) NOT NULL,
   `width` int(11) NOT NULL,
   `height` int(11) NOT NULL,
   `size` varchar(20) NOT NULL,
@@ -41,20 +43,52 @@ CREATE TABLE IF NOT EXISTS `lychee_photos` (
   `focal` varchar(20) NOT NULL,
   `takestamp` int(11) DEFAULT NULL,
   `star` tinyint(1) NOT NULL,
-  `thumbUrl` char(37) NOT NULL,
+  `thumbUrl` varchar(100) NOT NULL,
   `album` bigint(20) NOT NULL,
   `checksum` char(40) DEFAULT NULL,
   `medium` varchar(100) NOT NULL DEFAULT '',
+  `trashed` int(11) NOT NULL DEFAULT '0',
+  `latitude` decimal(10,8) DEFAULT NULL,
+  `longitude` decimal(11,8) DEFAULT NULL,
+  `altitude` decimal(10,4) DEFAULT NULL,
+  `imgDirection` decimal(10,4) DEFAULT NULL,
+  `lens` varchar(100) NOT NULL DEFAULT '',
+  `exposureBias` varchar(20) NOT NULL DEFAULT '',
+  PRIMARY KEY (`id`),
+  KEY `lychee_photos_url` (`url`),
+  KEY `lychee_photos_thumbUrl` (`thumbUrl`),
+  KEY `lychee_photos_medium` (`medium`),
+  KEY `lychee_photos_checksum` (`checksum`)
+);
+
+
+CREATE TABLE IF NOT EXISTS `lychee_sessions` (
+  `id` varchar(64) NOT NULL,
+  `data` text NOT NULL,
+  `created` int(11) NOT NULL,
+  `updated` int(11) NOT NULL,
   PRIMARY KEY (`id`)
 );
 
 
+CREATE TABLE IF NOT EXISTS `lychee_shares` (
+  `token` varchar(64) NOT NULL,
+  `photo` bigint(20) NOT NULL DEFAULT '0',
+  `album` bigint(20) NOT NULL DEFAULT '0',
+  `created` int(11) NOT NULL,
+  `expires` int(11) NOT NULL DEFAULT '0',
+  `views` int(11) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`token`)
+);
+
+
 CREATE TABLE IF NOT EXISTS `lychee_settings` (
   `key` varchar(50) NOT NULL DEFAULT '',
-  `value` varchar(200) DEFAULT ''
+  `value` varchar(200) DEFAULT '',
+  UNIQUE KEY `key` (`key`)
 );
 
-INSERT INTO `lychee_settings` (`key`, `value`)
+INSERT IGNORE INTO `lychee_settings` (`key`, `value`)
 VALUES
   ('version',''),
   ('username',''),
@@ -66,4 +100,5 @@ VALUES
   ('dropboxKey',''),
   ('identifier',''),
   ('skipDuplicates','0'),
-  ('plugins','');
+  ('plugins',''),
+  ('trashRetention','30');
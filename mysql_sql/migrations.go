@@ -0,0 +1,75 @@
+package mysql_sql
+
+import (
+	"database/sql"
+
+	"github.com/litao91/lychee_go/schema"
+)
+
+// Migrations mirrors the SQLite migrations version by version. MySQL commits
+// before every schema change, so unlike with SQLite a failed migration can
+// leave part of its changes behind; the steps are written to be rerun.
+var Migrations = []schema.Migration{
+	{Version: 1, Description: "initial schema", Up: schema.ExecStmts(
+		CreateAlbumsStmt, CreateLogStmt, CreatePhotosStmt, CreateSettingsStmt)},
+	{Version: 2, Description: "sessions table", Up: schema.ExecStmts(CreateSessionsStmt)},
+	{Version: 3, Description: "trash", Up: schema.AddColumns(hasColumn,
+		schema.Column{Table: "lychee_albums", Name: "trashed", Definition: "int(11) NOT NULL DEFAULT '0'"},
+		schema.Column{Table: "lychee_photos", Name: "trashed", Definition: "int(11) NOT NULL DEFAULT '0'"},
+	)},
+	{Version: 4, Description: "unique settings keys", Up: uniqueSettings},
+	{Version: 5, Description: "MIME photo types", Up: schema.ExecStmts(PhotoMimeTypesStmt)},
+	{Version: 6, Description: "wider photo types", Up: schema.ExecStmts(WidePhotoTypeStmt)},
+	{Version: 7, Description: "GPS and lens", Up: schema.AddColumns(hasColumn,
+		schema.Column{Table: "lychee_photos", Name: "latitude", Definition: "decimal(10,8) DEFAULT NULL"},
+		schema.Column{Table: "lychee_photos", Name: "longitude", Definition: "decimal(11,8) DEFAULT NULL"},
+		schema.Column{Table: "lychee_photos", Name: "altitude", Definition: "decimal(10,4) DEFAULT NULL"},
+		schema.Column{Table: "lychee_photos", Name: "imgDirection", Definition: "decimal(10,4) DEFAULT NULL"},
+		schema.Column{Table: "lychee_photos", Name: "lens", Definition: "varchar(100) NOT NULL DEFAULT ''"},
+		schema.Column{Table: "lychee_photos", Name: "exposureBias", Definition: "varchar(20) NOT NULL DEFAULT ''"},
+	)},
+	{Version: 8, Description: "share links", Up: schema.ExecStmts(CreateSharesStmt)},
+	// the file handler and duplicate detection look photos up by these
+	{Version: 9, Description: "photo file indexes", Up: schema.AddIndexes(hasIndex,
+		schema.Index{Table: "lychee_photos", Name: "lychee_photos_url", Columns: "url"},
+		schema.Index{Table: "lychee_photos", Name: "lychee_photos_thumbUrl", Columns: "thumbUrl"},
+		schema.Index{Table: "lychee_photos", Name: "lychee_photos_medium", Columns: "medium"},
+		schema.Index{Table: "lychee_photos", Name: "lychee_photos_checksum", Columns: "checksum"},
+	)},
+}
+
+// hasColumn looks the column up in information_schema
+func hasColumn(tx *sql.Tx, table string, name string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = ? AND column_name = ?`, table, name).Scan(&count)
+	return count > 0, err
+}
+
+// hasIndex looks the index up in information_schema
+func hasIndex(tx *sql.Tx, table string, name string) (bool, error) {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = ? AND index_name = ?`, table, name).Scan(&count)
+	return count > 0, err
+}
+
+// uniqueSettings adds the unique index on the settings keys and the default
+// settings. Libraries kept in MySQL never inserted the defaults twice, so
+// unlike on SQLite there are no duplicates to drop first.
+func uniqueSettings(tx *sql.Tx) error {
+	var count int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = 'lychee_settings' AND index_name = 'lychee_settings_key'`).Scan(&count)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		_, err = tx.Exec("CREATE UNIQUE INDEX lychee_settings_key ON lychee_settings (`key`)")
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(DefaultSettingsStmt)
+	return err
+}
@@ -0,0 +1,154 @@
+// Package schema runs the versioned migrations of the library schema. The
+// migrations themselves are kept per database in sqlite_sql and mysql_sql.
+package schema
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/litao91/lychee_go/util/log"
+)
+
+// Migration upgrades the schema by one version. Up runs in a transaction and
+// has to cope with libraries created before versions were recorded, which
+// may already contain parts of the change.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(tx *sql.Tx) error
+}
+
+const createVersionTableStmt = `
+CREATE TABLE IF NOT EXISTS schema_version (
+  version int(11) NOT NULL,
+  description varchar(100) NOT NULL DEFAULT '',
+  applied int(11) NOT NULL,
+  PRIMARY KEY (version)
+);
+`
+
+// ExecStmts returns a migration step running the statements in order. Each
+// statement is run on its own, the MySQL driver refuses several at once.
+func ExecStmts(stmts ...string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, stmt := range stmts {
+			_, err := tx.Exec(stmt)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Column is a column added by a migration
+type Column struct {
+	Table      string
+	Name       string
+	Definition string
+}
+
+// AddColumns returns a migration step adding the columns that don't exist
+// yet, exists looks them up in a way the database understands
+func AddColumns(exists func(tx *sql.Tx, table string, name string) (bool, error), columns ...Column) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, c := range columns {
+			found, err := exists(tx, c.Table, c.Name)
+			if err != nil {
+				return err
+			}
+			if found {
+				continue
+			}
+			_, err = tx.Exec("ALTER TABLE " + c.Table + " ADD COLUMN " + c.Name + " " + c.Definition)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Index is an index added by a migration
+type Index struct {
+	Table   string
+	Name    string
+	Columns string
+}
+
+// AddIndexes returns a migration step adding the indexes that don't exist
+// yet, exists looks them up in a way the database understands
+func AddIndexes(exists func(tx *sql.Tx, table string, name string) (bool, error), indexes ...Index) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		for _, i := range indexes {
+			found, err := exists(tx, i.Table, i.Name)
+			if err != nil {
+				return err
+			}
+			if found {
+				continue
+			}
+			_, err = tx.Exec("CREATE INDEX " + i.Name + " ON " + i.Table + " (" + i.Columns + ")")
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// CurrentVersion returns the schema version of the library, 0 for a new one
+func CurrentVersion(db *sql.DB) (version int, err error) {
+	_, err = db.Exec(createVersionTableStmt)
+	if err != nil {
+		return
+	}
+	err = db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&version)
+	return
+}
+
+// Pending returns the migrations not applied to the library yet
+func Pending(db *sql.DB, migrations []Migration) (pending []Migration, err error) {
+	version, err := CurrentVersion(db)
+	if err != nil {
+		return
+	}
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	return
+}
+
+// Migrate applies the pending migrations, each in its own transaction
+func Migrate(db *sql.DB, migrations []Migration) (applied []Migration, err error) {
+	pending, err := Pending(db, migrations)
+	if err != nil {
+		return
+	}
+	for _, m := range pending {
+		log.Info("Migrating schema to version %d: %s", m.Version, m.Description)
+		var tx *sql.Tx
+		tx, err = db.Begin()
+		if err != nil {
+			return
+		}
+		err = m.Up(tx)
+		if err == nil {
+			_, err = tx.Exec("INSERT INTO schema_version (version, description, applied) VALUES (?, ?, ?)",
+				m.Version, m.Description, time.Now().Unix())
+		}
+		if err != nil {
+			tx.Rollback()
+			log.Error("Migration %d failed: %v", m.Version, err)
+			return
+		}
+		err = tx.Commit()
+		if err != nil {
+			return
+		}
+		applied = append(applied, m)
+	}
+	return
+}
@@ -1,12 +1,7 @@
 package sqlite_sql
 
-import (
-	"database/sql"
-
-	"github.com/litao91/lychee_go/util/log"
-	_ "github.com/mattn/go-sqlite3"
-)
-
+// CreateTableStmt is the schema of the first release, the starting point of
+// the migrations
 var CreateTableStmt string = `
 CREATE TABLE IF NOT EXISTS lychee_albums (
   id bigint(14) NOT NULL,
@@ -62,8 +57,42 @@ CREATE TABLE IF NOT EXISTS lychee_settings (
   key varchar(50) NOT NULL DEFAULT '',
   value varchar(200) DEFAULT ''
 );
+`
+
+var CreateSessionsStmt string = `
+CREATE TABLE IF NOT EXISTS lychee_sessions (
+  id varchar(64) NOT NULL,
+  data text NOT NULL,
+  created int(11) NOT NULL,
+  updated int(11) NOT NULL,
+  PRIMARY KEY (id)
+);
+`
+
+// CreateSharesStmt holds the share links of photos and albums, one of photo
+// and album is set
+var CreateSharesStmt string = `
+CREATE TABLE IF NOT EXISTS lychee_shares (
+  token varchar(64) NOT NULL,
+  photo bigint(14) NOT NULL DEFAULT '0',
+  album bigint(14) NOT NULL DEFAULT '0',
+  created int(11) NOT NULL,
+  expires int(11) NOT NULL DEFAULT '0',
+  views int(11) NOT NULL DEFAULT '0',
+  PRIMARY KEY (token)
+);
+`
 
-INSERT INTO lychee_settings (key, value)
+// UniqueSettingsStmt drops the duplicate settings earlier versions inserted
+// on every start and makes sure it can't happen again
+var UniqueSettingsStmt string = `
+DELETE FROM lychee_settings WHERE rowid NOT IN (
+  SELECT MAX(rowid) FROM lychee_settings GROUP BY key
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS lychee_settings_key ON lychee_settings (key);
+
+INSERT OR IGNORE INTO lychee_settings (key, value)
 VALUES
   ('version',''),
   ('username',''),
@@ -75,16 +104,12 @@ VALUES
   ('dropboxKey',''),
   ('identifier',''),
   ('skipDuplicates','0'),
-  ('plugins','');
+  ('plugins',''),
+  ('trashRetention','30');
 `
 
-func InitTables(dbpath string) (err error) {
-	db, err := sql.Open("sqlite3", dbpath)
-	defer db.Close()
-	if err != nil {
-		log.Error("Can't open db on %s: %v", dbpath, err)
-		return
-	}
-	_, err = db.Exec(CreateTableStmt)
-	return
-}
+// PhotoMimeTypesStmt replaces the image format stored by earlier versions
+// with the MIME type PHP Lychee uses
+var PhotoMimeTypesStmt string = `
+UPDATE lychee_photos SET type = 'image/jpeg' WHERE type = 'jpeg'
+`
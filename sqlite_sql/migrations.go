@@ -0,0 +1,77 @@
+package sqlite_sql
+
+import (
+	"database/sql"
+
+	"github.com/litao91/lychee_go/schema"
+)
+
+// Migrations lists every schema change in order. Never edit a released
+// migration, append a new one instead.
+var Migrations = []schema.Migration{
+	{Version: 1, Description: "initial schema", Up: schema.ExecStmts(CreateTableStmt)},
+	{Version: 2, Description: "sessions table", Up: schema.ExecStmts(CreateSessionsStmt)},
+	{Version: 3, Description: "trash", Up: schema.AddColumns(hasColumn,
+		schema.Column{Table: "lychee_albums", Name: "trashed", Definition: "int(11) NOT NULL DEFAULT '0'"},
+		schema.Column{Table: "lychee_photos", Name: "trashed", Definition: "int(11) NOT NULL DEFAULT '0'"},
+	)},
+	{Version: 4, Description: "unique settings keys", Up: schema.ExecStmts(UniqueSettingsStmt)},
+	{Version: 5, Description: "MIME photo types", Up: schema.ExecStmts(PhotoMimeTypesStmt)},
+	// SQLite doesn't enforce the size of varchar columns
+	{Version: 6, Description: "wider photo types", Up: schema.ExecStmts()},
+	{Version: 7, Description: "GPS and lens", Up: schema.AddColumns(hasColumn,
+		schema.Column{Table: "lychee_photos", Name: "latitude", Definition: "decimal(10,8) DEFAULT NULL"},
+		schema.Column{Table: "lychee_photos", Name: "longitude", Definition: "decimal(11,8) DEFAULT NULL"},
+		schema.Column{Table: "lychee_photos", Name: "altitude", Definition: "decimal(10,4) DEFAULT NULL"},
+		schema.Column{Table: "lychee_photos", Name: "imgDirection", Definition: "decimal(10,4) DEFAULT NULL"},
+		schema.Column{Table: "lychee_photos", Name: "lens", Definition: "varchar(100) NOT NULL DEFAULT ''"},
+		schema.Column{Table: "lychee_photos", Name: "exposureBias", Definition: "varchar(20) NOT NULL DEFAULT ''"},
+	)},
+	{Version: 8, Description: "share links", Up: schema.ExecStmts(CreateSharesStmt)},
+	// the file handler and duplicate detection look photos up by these
+	{Version: 9, Description: "photo file indexes", Up: schema.AddIndexes(hasIndex,
+		schema.Index{Table: "lychee_photos", Name: "lychee_photos_url", Columns: "url"},
+		schema.Index{Table: "lychee_photos", Name: "lychee_photos_thumbUrl", Columns: "thumbUrl"},
+		schema.Index{Table: "lychee_photos", Name: "lychee_photos_medium", Columns: "medium"},
+		schema.Index{Table: "lychee_photos", Name: "lychee_photos_checksum", Columns: "checksum"},
+	)},
+}
+
+// hasColumn looks the column up with PRAGMA table_info
+func hasColumn(tx *sql.Tx, table string, name string) (bool, error) {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return false, err
+	}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		var colName string
+		for i := range values {
+			if cols[i] == "name" {
+				values[i] = &colName
+			} else {
+				values[i] = new(interface{})
+			}
+		}
+		err = rows.Scan(values...)
+		if err != nil {
+			return false, err
+		}
+		if colName == name {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// hasIndex looks the index up in sqlite_master
+func hasIndex(tx *sql.Tx, table string, name string) (bool, error) {
+	var count int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name = ?", table, name).Scan(&count)
+	return count > 0, err
+}
@@ -1,16 +1,67 @@
 package helper
 
 import (
+	"crypto/rand"
 	"crypto/sha1"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// IDs count ten-thousandths of a second since the epoch, which gives the 14
+// digit IDs PHP Lychee uses for its bigint(14) columns
+const idUnitsPerSecond = 10000
+
+// legacyIDLimit separates IDs counting whole seconds, as generated by earlier
+// versions, from the current ones
+const legacyIDLimit = 100000000000
+
+var (
+	idLock sync.Mutex
+	lastID int64
 )
 
+// NextID returns a unique ID for a photo or album. IDs increase strictly,
+// even when several are requested within the same tick, so they still sort
+// chronologically. They are only unique within this process, another one
+// sharing the library can generate the same ID at the same time, so inserts
+// must be retried with the next ID when the ID is taken.
+func NextID() int64 {
+	id := TimeID(time.Now())
+	idLock.Lock()
+	defer idLock.Unlock()
+	if id <= lastID {
+		id = lastID + 1
+	}
+	lastID = id
+	return id
+}
+
 func GenerateID() string {
-	return fmt.Sprintf("%d", time.Now().Unix())
+	return strconv.FormatInt(NextID(), 10)
+}
+
+// TimeID returns the smallest ID generated at or after t
+func TimeID(t time.Time) int64 {
+	return t.UnixNano() / (int64(time.Second) / idUnitsPerSecond)
+}
+
+// IDTime returns the time the ID was generated at
+func IDTime(id int64) time.Time {
+	if id < legacyIDLimit {
+		return time.Unix(id, 0)
+	}
+	return time.Unix(id/idUnitsPerSecond, (id%idUnitsPerSecond)*(int64(time.Second)/idUnitsPerSecond))
 }
 
 func HashFileSha1(filePath string) (string, error) {
@@ -116,3 +167,61 @@ func DoesFileExists(f string) bool {
 	}
 	return true
 }
+
+// HashPassword returns a bcrypt hash of plain, compatible with the crypt()
+// hashes written by PHP Lychee
+func HashPassword(plain string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plain), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether plain matches the bcrypt hash. An empty hash
+// never matches.
+func CheckPassword(hash string, plain string) bool {
+	if hash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(plain)) == nil
+}
+
+// LoadOrCreateKey reads a secret key from keyPath, generating and persisting
+// a random one of the given length if the file doesn't exist yet
+func LoadOrCreateKey(keyPath string, length int) ([]byte, error) {
+	key, err := ioutil.ReadFile(keyPath)
+	if err == nil {
+		if len(key) < length {
+			return nil, fmt.Errorf("key file %s is too short", keyPath)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	key = make([]byte, length)
+	if _, err = rand.Read(key); err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(keyPath, key, 0600)
+	return key, err
+}
+
+// RandomToken returns a URL safe random token of the given number of bytes
+func RandomToken(length int) (string, error) {
+	b := make([]byte, length)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// IsInsideDir reports whether file lies within dir, after resolving any ".."
+func IsInsideDir(dir string, file string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(file))
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -4,7 +4,6 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"strings"
 
 	"github.com/litao91/lychee_go/modules"
 	"github.com/litao91/lychee_go/util/helper"
@@ -37,12 +36,12 @@ func main() {
 		log.Error("%v", err)
 		return
 	}
-	defer db.Close()
+	defer server.Close()
 
 	fileList := [][]string{}
 
 	err = filepath.Walk(pd, func(path string, f os.FileInfo, err error) error {
-		if !f.IsDir() && strings.HasSuffix(strings.ToLower(path), ".jpg") {
+		if !f.IsDir() && modules.SupportedFile(path) {
 			fileList = append(fileList, []string{path, f.Name()})
 		}
 		return nil
@@ -56,7 +55,8 @@ func main() {
 			log.Error("%v", err)
 			continue
 		}
-		err = p.SavePhoto(db, false)
+		// skip what an earlier run imported already
+		err = p.SavePhoto(db, false, true)
 		if err != nil {
 			log.Error("%v", err)
 		}
@@ -0,0 +1,234 @@
+// Package mysqldump reads the tables of a SQL file written by mysqldump. It
+// understands CREATE TABLE, for the column order, and INSERT INTO with one
+// or more rows, everything else in the file is skipped.
+package mysqldump
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Table is a table of the dump with its rows. Values are kept as the text
+// MySQL printed, NULL values are not Valid.
+type Table struct {
+	Name    string
+	Columns []string
+	Rows    [][]sql.NullString
+}
+
+// Column returns the index of the named column, or -1
+func (t *Table) Column(name string) int {
+	for i, c := range t.Columns {
+		if strings.EqualFold(c, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Maps returns the rows keyed by column name
+func (t *Table) Maps() []map[string]sql.NullString {
+	rows := make([]map[string]sql.NullString, 0, len(t.Rows))
+	for _, r := range t.Rows {
+		m := make(map[string]sql.NullString, len(t.Columns))
+		for i, c := range t.Columns {
+			if i < len(r) {
+				m[c] = r[i]
+			}
+		}
+		rows = append(rows, m)
+	}
+	return rows
+}
+
+// Dump holds the tables of a dump by name
+type Dump struct {
+	Tables map[string]*Table
+}
+
+// Table finds a table by name, ignoring any prefix the installation put in
+// front of the table names
+func (d *Dump) Table(name string) *Table {
+	if t, ok := d.Tables[name]; ok {
+		return t
+	}
+	for n, t := range d.Tables {
+		if strings.HasSuffix(n, name) {
+			return t
+		}
+	}
+	return nil
+}
+
+// Parse reads a dump
+func Parse(r io.Reader) (*Dump, error) {
+	d := &Dump{Tables: map[string]*Table{}}
+	s := &scanner{r: bufio.NewReader(r)}
+	for {
+		stmt, err := s.statement()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(stmt) > 0 {
+			perr := d.parseStatement(stmt)
+			if perr != nil {
+				return nil, perr
+			}
+		}
+		if err == io.EOF {
+			return d, nil
+		}
+	}
+}
+
+func (d *Dump) parseStatement(stmt []token) error {
+	switch {
+	case stmt[0].is("CREATE") && len(stmt) > 1 && stmt[1].is("TABLE"):
+		return d.parseCreate(stmt[2:])
+	case stmt[0].is("INSERT") || stmt[0].is("REPLACE"):
+		return d.parseInsert(stmt[1:])
+	}
+	return nil
+}
+
+// skipWords drops the optional keywords in front of a table name
+func skipWords(stmt []token, words ...string) []token {
+	for len(stmt) > 0 {
+		skipped := false
+		for _, w := range words {
+			if stmt[0].is(w) {
+				stmt = stmt[1:]
+				skipped = true
+				break
+			}
+		}
+		if !skipped {
+			break
+		}
+	}
+	return stmt
+}
+
+func (d *Dump) table(name string) *Table {
+	t, ok := d.Tables[name]
+	if !ok {
+		t = &Table{Name: name}
+		d.Tables[name] = t
+	}
+	return t
+}
+
+func (d *Dump) parseCreate(stmt []token) error {
+	stmt = skipWords(stmt, "IF", "NOT", "EXISTS")
+	if len(stmt) < 2 || !stmt[0].isName() || !stmt[1].isPunct('(') {
+		return fmt.Errorf("mysqldump: malformed CREATE TABLE")
+	}
+	t := d.table(stmt[0].text)
+	t.Columns = nil
+	// every definition starting with a quoted name at depth one is a column,
+	// keys and constraints start with a keyword
+	depth := 0
+	start := true
+	for _, tok := range stmt[1:] {
+		switch {
+		case tok.isPunct('('):
+			depth++
+			continue
+		case tok.isPunct(')'):
+			depth--
+			continue
+		case tok.isPunct(',') && depth == 1:
+			start = true
+			continue
+		}
+		if start && depth == 1 && tok.kind == tokenIdent {
+			t.Columns = append(t.Columns, tok.text)
+		}
+		start = false
+	}
+	if depth != 0 {
+		return fmt.Errorf("mysqldump: unterminated CREATE TABLE %s", t.Name)
+	}
+	return nil
+}
+
+func (d *Dump) parseInsert(stmt []token) error {
+	stmt = skipWords(stmt, "LOW_PRIORITY", "DELAYED", "HIGH_PRIORITY", "IGNORE", "INTO")
+	if len(stmt) == 0 || !stmt[0].isName() {
+		return fmt.Errorf("mysqldump: malformed INSERT")
+	}
+	t := d.table(stmt[0].text)
+	stmt = stmt[1:]
+
+	columns := t.Columns
+	if len(stmt) > 0 && stmt[0].isPunct('(') {
+		columns = nil
+		i := 1
+		for ; i < len(stmt) && !stmt[i].isPunct(')'); i++ {
+			if stmt[i].isName() {
+				columns = append(columns, stmt[i].text)
+			}
+		}
+		stmt = stmt[i+1:]
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("mysqldump: no columns known for %s", t.Name)
+	}
+	if t.Columns == nil {
+		t.Columns = columns
+	}
+	order := make([]int, len(columns))
+	for i, c := range columns {
+		order[i] = t.Column(c)
+		if order[i] < 0 {
+			return fmt.Errorf("mysqldump: unknown column %s in %s", c, t.Name)
+		}
+	}
+
+	stmt = skipWords(stmt, "VALUES", "VALUE")
+	for len(stmt) > 0 {
+		if stmt[0].isPunct(',') {
+			stmt = stmt[1:]
+			continue
+		}
+		if !stmt[0].isPunct('(') {
+			// ON DUPLICATE KEY UPDATE and the like
+			break
+		}
+		row := make([]sql.NullString, len(t.Columns))
+		n := 0
+		i := 1
+		for ; i < len(stmt) && !stmt[i].isPunct(')'); i++ {
+			tok := stmt[i]
+			if tok.isPunct(',') {
+				continue
+			}
+			if tok.isPunct('-') && i+1 < len(stmt) {
+				i++
+				tok = token{kind: tokenWord, text: "-" + stmt[i].text}
+			}
+			if tok.is("_binary") || tok.is("_utf8") || tok.is("_utf8mb4") {
+				continue
+			}
+			if n >= len(order) {
+				return fmt.Errorf("mysqldump: too many values for %s", t.Name)
+			}
+			if !tok.is("NULL") {
+				row[order[n]] = sql.NullString{String: tok.text, Valid: true}
+			}
+			n++
+		}
+		if i >= len(stmt) {
+			return fmt.Errorf("mysqldump: unterminated row in %s", t.Name)
+		}
+		if n != len(order) {
+			return fmt.Errorf("mysqldump: expected %d values for %s, got %d", len(order), t.Name, n)
+		}
+		t.Rows = append(t.Rows, row)
+		stmt = stmt[i+1:]
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package mysqldump
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const createPhotos = "CREATE TABLE `lychee_photos` (\n" +
+	"  `id` bigint(14) unsigned NOT NULL,\n" +
+	"  `title` varchar(100) NOT NULL DEFAULT '',\n" +
+	"  `takestamp` int(11) DEFAULT NULL,\n" +
+	"  PRIMARY KEY (`id`),\n" +
+	"  KEY `Index_album` (`title`)\n" +
+	") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;\n"
+
+func value(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: true}
+}
+
+var null = sql.NullString{}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		dump    string
+		columns []string
+		rows    [][]sql.NullString
+	}{
+		{
+			name:    "doubled quote",
+			dump:    createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'it''s',NULL);",
+			columns: []string{"id", "title", "takestamp"},
+			rows:    [][]sql.NullString{{value("1"), value("it's"), null}},
+		},
+		{
+			name:    "backslash escapes",
+			dump:    createPhotos + `INSERT INTO lychee_photos VALUES (1,'it\'s \"a\"\n\\',2);`,
+			columns: []string{"id", "title", "takestamp"},
+			rows:    [][]sql.NullString{{value("1"), value("it's \"a\"\n\\"), value("2")}},
+		},
+		{
+			name: "comments",
+			dump: "-- MySQL dump 10.13\n" +
+				"# a hash comment\n" +
+				"/*!40101 SET @OLD_CHARACTER_SET_CLIENT=@@CHARACTER_SET_CLIENT */;\n" +
+				"/* a block\n comment; spanning lines */\n" +
+				createPhotos +
+				"INSERT INTO `lychee_photos` VALUES /* inline */ (1,'a',NULL); -- trailing\n",
+			columns: []string{"id", "title", "takestamp"},
+			rows:    [][]sql.NullString{{value("1"), value("a"), null}},
+		},
+		{
+			name:    "comment markers inside strings",
+			dump:    createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'-- not /* a */ comment #',NULL);",
+			columns: []string{"id", "title", "takestamp"},
+			rows:    [][]sql.NullString{{value("1"), value("-- not /* a */ comment #"), null}},
+		},
+		{
+			name:    "semicolon inside string",
+			dump:    createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'a;b',NULL);\nINSERT INTO `lychee_photos` VALUES (2,';',3);",
+			columns: []string{"id", "title", "takestamp"},
+			rows: [][]sql.NullString{
+				{value("1"), value("a;b"), null},
+				{value("2"), value(";"), value("3")},
+			},
+		},
+		{
+			name:    "multi-row insert with NULL",
+			dump:    createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'a',NULL),(2,'b',1500000000),\n(3,NULL,NULL);",
+			columns: []string{"id", "title", "takestamp"},
+			rows: [][]sql.NullString{
+				{value("1"), value("a"), null},
+				{value("2"), value("b"), value("1500000000")},
+				{value("3"), null, null},
+			},
+		},
+		{
+			name:    "negative numbers",
+			dump:    createPhotos + "INSERT INTO `lychee_photos` VALUES (-1,'a',-1.5);",
+			columns: []string{"id", "title", "takestamp"},
+			rows:    [][]sql.NullString{{value("-1"), value("a"), value("-1.5")}},
+		},
+		{
+			name:    "column list reorders values",
+			dump:    createPhotos + "INSERT INTO `lychee_photos` (`title`, `id`, `takestamp`) VALUES ('a',1,NULL);",
+			columns: []string{"id", "title", "takestamp"},
+			rows:    [][]sql.NullString{{value("1"), value("a"), null}},
+		},
+		{
+			name:    "no CREATE TABLE",
+			dump:    "INSERT IGNORE INTO `lychee_photos` (`id`, `title`) VALUES (1,'a'),(2,'b');",
+			columns: []string{"id", "title"},
+			rows: [][]sql.NullString{
+				{value("1"), value("a")},
+				{value("2"), value("b")},
+			},
+		},
+		{
+			name:    "last statement without semicolon",
+			dump:    createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'a',NULL)\n",
+			columns: []string{"id", "title", "takestamp"},
+			rows:    [][]sql.NullString{{value("1"), value("a"), null}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, err := Parse(strings.NewReader(tt.dump))
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			table := d.Table("lychee_photos")
+			if table == nil {
+				t.Fatalf("table lychee_photos not found")
+			}
+			if !reflect.DeepEqual(table.Columns, tt.columns) {
+				t.Errorf("columns = %q, want %q", table.Columns, tt.columns)
+			}
+			if !reflect.DeepEqual(table.Rows, tt.rows) {
+				t.Errorf("rows = %v, want %v", table.Rows, tt.rows)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		dump string
+	}{
+		{"truncated string", createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'a"},
+		{"truncated escape", createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'a\\"},
+		{"truncated row", createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'a',NULL"},
+		{"truncated second row", createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'a',NULL),(2,"},
+		{"truncated CREATE TABLE", "CREATE TABLE `lychee_photos` (\n  `id` bigint(14) NOT NULL,\n  `title`"},
+		{"too few values", createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'a');"},
+		{"too many values", createPhotos + "INSERT INTO `lychee_photos` VALUES (1,'a',NULL,4);"},
+		{"unknown column", createPhotos + "INSERT INTO `lychee_photos` (`id`, `url`) VALUES (1,'a');"},
+		{"no columns known", "INSERT INTO `lychee_photos` VALUES (1,'a');"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.dump)); err == nil {
+				t.Errorf("Parse succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestDumpTablePrefix(t *testing.T) {
+	d, err := Parse(strings.NewReader("INSERT INTO `ly_lychee_albums` (`id`) VALUES (1);"))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if d.Table("lychee_albums") == nil {
+		t.Errorf("prefixed table not found")
+	}
+	if d.Table("lychee_photos") != nil {
+		t.Errorf("found a table that isn't in the dump")
+	}
+}
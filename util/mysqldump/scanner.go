@@ -0,0 +1,184 @@
+package mysqldump
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	// tokenWord is a keyword, bare name or number
+	tokenWord tokenKind = iota
+	// tokenIdent is a name quoted in backticks
+	tokenIdent
+	tokenString
+	tokenPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// is reports whether the token is the given keyword
+func (t token) is(word string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, word)
+}
+
+func (t token) isPunct(c byte) bool {
+	return t.kind == tokenPunct && t.text[0] == c
+}
+
+func (t token) isName() bool {
+	return t.kind == tokenIdent || t.kind == tokenWord
+}
+
+// scanner splits a dump into statements of tokens, dropping comments
+type scanner struct {
+	r *bufio.Reader
+}
+
+// statement returns the tokens up to the next semicolon, io.EOF is returned
+// together with the last statement
+func (s *scanner) statement() (stmt []token, err error) {
+	for {
+		var c byte
+		c, err = s.r.ReadByte()
+		if err != nil {
+			return
+		}
+		switch {
+		case c == ';':
+			return
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+		case c == '#':
+			err = s.skipLine()
+		case c == '-' && s.peekIs('-'):
+			// "--" only starts a comment when followed by a space
+			s.r.ReadByte()
+			if s.peekIs(' ') || s.peekIs('\t') || s.peekIs('\n') || s.peekIs('\r') {
+				err = s.skipLine()
+			} else {
+				stmt = append(stmt, token{kind: tokenPunct, text: "-"}, token{kind: tokenPunct, text: "-"})
+			}
+		case c == '/' && s.peekIs('*'):
+			// versioned comments like /*!40101 SET ... */ are skipped too,
+			// they only carry session settings
+			s.r.ReadByte()
+			err = s.skipComment()
+		case c == '\'' || c == '"':
+			var text string
+			text, err = s.quoted(c)
+			stmt = append(stmt, token{kind: tokenString, text: text})
+		case c == '`':
+			var text string
+			text, err = s.quoted(c)
+			stmt = append(stmt, token{kind: tokenIdent, text: text})
+		case isWordByte(c):
+			word := []byte{c}
+			for {
+				c, err = s.r.ReadByte()
+				if err != nil {
+					break
+				}
+				if !isWordByte(c) {
+					s.r.UnreadByte()
+					break
+				}
+				word = append(word, c)
+			}
+			stmt = append(stmt, token{kind: tokenWord, text: string(word)})
+		default:
+			stmt = append(stmt, token{kind: tokenPunct, text: string(c)})
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '_' || c == '.' || c == '$' || c >= 0x80
+}
+
+func (s *scanner) peekIs(c byte) bool {
+	b, err := s.r.Peek(1)
+	return err == nil && b[0] == c
+}
+
+func (s *scanner) skipLine() error {
+	_, err := s.r.ReadString('\n')
+	return err
+}
+
+func (s *scanner) skipComment() error {
+	for {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if c == '*' && s.peekIs('/') {
+			s.r.ReadByte()
+			return nil
+		}
+	}
+}
+
+// quoted reads a string or name up to the closing quote, undoing the
+// escaping mysqldump applies
+func (s *scanner) quoted(quote byte) (string, error) {
+	var b strings.Builder
+	for {
+		c, err := s.r.ReadByte()
+		if err == io.EOF {
+			return "", fmt.Errorf("mysqldump: unterminated %c", quote)
+		}
+		if err != nil {
+			return "", err
+		}
+		if c == quote {
+			// a doubled quote stands for the quote itself
+			if s.peekIs(quote) {
+				s.r.ReadByte()
+				b.WriteByte(quote)
+				continue
+			}
+			return b.String(), nil
+		}
+		if c == '\\' && quote != '`' {
+			c, err = s.r.ReadByte()
+			if err != nil {
+				return "", fmt.Errorf("mysqldump: unterminated %c", quote)
+			}
+			switch c {
+			case '0':
+				b.WriteByte(0)
+			case 'b':
+				b.WriteByte('\b')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'Z':
+				b.WriteByte(26)
+			case '%', '_':
+				// kept escaped, as MySQL does outside of LIKE patterns
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			default:
+				b.WriteByte(c)
+			}
+			continue
+		}
+		b.WriteByte(c)
+	}
+}